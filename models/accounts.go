@@ -1,11 +1,19 @@
 package models
 
 import (
+	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/equinor/radix-common/utils"
 	jwt "github.com/golang-jwt/jwt/v5"
 )
 
+// ErrTokenHasNoExpirationTime The token does not have an exp claim
+var ErrTokenHasNoExpirationTime = errors.New("token has no expiration time")
+
 // NewAccounts creates a new Accounts struct
 func NewAccounts(
 	token string,
@@ -17,10 +25,51 @@ func NewAccounts(
 	}
 }
 
+// TokenVerifier Verifies the signature of a bearer token, and returns the verified claims
+type TokenVerifier func(ctx context.Context, token string) (jwt.MapClaims, error)
+
+// JWTTokenVerifier Verifies the signature and lifetime of JWTs with the key function
+func JWTTokenVerifier(keyFunc jwt.Keyfunc, options ...jwt.ParserOption) TokenVerifier {
+	parser := jwt.NewParser(options...)
+	return func(_ context.Context, token string) (jwt.MapClaims, error) {
+		claims := jwt.MapClaims{}
+		if _, err := parser.ParseWithClaims(token, claims, keyFunc); err != nil {
+			return nil, err
+		}
+		return claims, nil
+	}
+}
+
+// NewClientCertificateAccounts creates a new Accounts struct for a caller authenticated with a client certificate
+func NewClientCertificateAccounts(identity ClientIdentity) Accounts {
+	return Accounts{clientIdentity: &identity}
+}
+
+// NewSignedURLAccounts creates a new Accounts struct for a caller authenticated with a signed URL issued for the principal.
+// The accounts have no token, so the handler must access the k8s API with its own credentials
+func NewSignedURLAccounts(principal string) Accounts {
+	return Accounts{signedURLPrincipal: principal}
+}
+
+// ClientIdentity identity of a caller authenticated with a verified client certificate
+type ClientIdentity struct {
+	// Principal Identity mapped from the certificate, e.g. the SPIFFE ID or the subject common name
+	Principal string
+	// Groups Groups of the caller, e.g. the subject organizations
+	Groups []string
+	// Certificate The verified client certificate
+	Certificate *x509.Certificate
+}
+
 // Accounts contains accounts for accessing k8s API.
 type Accounts struct {
-	token         string
-	impersonation Impersonation
+	token          string
+	impersonation  Impersonation
+	clientIdentity *ClientIdentity
+	// verifiedClaims claims of the token, when the token signature is verified
+	verifiedClaims jwt.MapClaims
+	// signedURLPrincipal principal of a caller authenticated with a signed URL
+	signedURLPrincipal string
 }
 
 // GetUserAccountUserPrincipleName get the user principle name represented in UserAccount
@@ -28,15 +77,168 @@ func (accounts Accounts) GetUserAccountUserPrincipleName() (string, error) {
 	if accounts.impersonation.PerformImpersonation() {
 		return accounts.impersonation.User, nil
 	}
+	if accounts.clientIdentity != nil {
+		return accounts.clientIdentity.Principal, nil
+	}
+	if len(accounts.signedURLPrincipal) > 0 {
+		return accounts.signedURLPrincipal, nil
+	}
 
 	return GetUserPrincipleNameFromToken(accounts.token)
 }
 
+// GetPrincipal get the identity of the authenticated caller from the upn claim, or the sub claim when upn is missing.
+// For callers authenticated with a client certificate or a signed URL, the principal of the certificate or URL is returned.
+// Returns an empty string when the caller is not authenticated. Impersonation does not change the principal
+func (accounts Accounts) GetPrincipal() string {
+	if accounts.clientIdentity != nil {
+		return accounts.clientIdentity.Principal
+	}
+	if len(accounts.signedURLPrincipal) > 0 {
+		return accounts.signedURLPrincipal
+	}
+	claims, err := parseUnverifiedClaims(accounts.token)
+	if err != nil {
+		return ""
+	}
+	if upn, ok := claims["upn"].(string); ok && len(upn) > 0 {
+		return upn
+	}
+	sub, _ := claims.GetSubject()
+	return sub
+}
+
+// WithVerifiedClaims returns a copy of the accounts with the claims of the verified token, see TokenVerifier
+func (accounts Accounts) WithVerifiedClaims(claims jwt.MapClaims) Accounts {
+	accounts.verifiedClaims = claims
+	return accounts
+}
+
+// GetAuthenticatedPrincipal get the principal of the authenticated caller, from the verified token, the client certificate
+// or the signed URL. Returns false when the principal is not verified
+func (accounts Accounts) GetAuthenticatedPrincipal() (string, bool) {
+	switch {
+	case accounts.clientIdentity != nil:
+		return accounts.clientIdentity.Principal, true
+	case len(accounts.signedURLPrincipal) > 0:
+		return accounts.signedURLPrincipal, true
+	case accounts.verifiedClaims != nil:
+		if upn, ok := accounts.verifiedClaims["upn"].(string); ok && len(upn) > 0 {
+			return upn, true
+		}
+		sub, _ := accounts.verifiedClaims.GetSubject()
+		return sub, len(sub) > 0
+	}
+	return "", false
+}
+
+// GetAuthenticatedGroups get the groups of the authenticated caller, from the verified token or the client certificate.
+// Returns false when the groups are not verified. Impersonated groups are never returned
+func (accounts Accounts) GetAuthenticatedGroups() ([]string, bool) {
+	if accounts.clientIdentity != nil {
+		return accounts.clientIdentity.Groups, true
+	}
+	if accounts.verifiedClaims != nil {
+		return stringsClaim(accounts.verifiedClaims, "groups"), true
+	}
+	return nil, false
+}
+
+// GetAuthenticatedAppRoles get the app roles of the authenticated caller from the verified token.
+// Returns false when the app roles are not verified. Client certificates have no app roles
+func (accounts Accounts) GetAuthenticatedAppRoles() ([]string, bool) {
+	if accounts.clientIdentity != nil {
+		return nil, true
+	}
+	if accounts.verifiedClaims != nil {
+		return stringsClaim(accounts.verifiedClaims, "roles"), true
+	}
+	return nil, false
+}
+
 // GetToken get the user token
 func (accounts Accounts) GetToken() string {
 	return accounts.token
 }
 
+// GetClientIdentity get the identity of a caller authenticated with a client certificate, or nil for other callers
+func (accounts Accounts) GetClientIdentity() *ClientIdentity {
+	return accounts.clientIdentity
+}
+
+// GetImpersonation get the impersonation requested by the user
+func (accounts Accounts) GetImpersonation() Impersonation {
+	return accounts.impersonation
+}
+
+// GetGroups get the groups of the user, either from impersonation or from the groups claim in the token
+func (accounts Accounts) GetGroups() ([]string, error) {
+	if accounts.impersonation.PerformImpersonation() {
+		return accounts.impersonation.Groups, nil
+	}
+	if accounts.clientIdentity != nil {
+		return accounts.clientIdentity.Groups, nil
+	}
+	if len(accounts.signedURLPrincipal) > 0 {
+		return nil, nil
+	}
+
+	return GetGroupsFromToken(accounts.token)
+}
+
+// GetAppRoles get the app roles of the user from the roles claim in the token.
+// App roles are not known for impersonated users, client certificates or signed URLs, so none are returned
+func (accounts Accounts) GetAppRoles() ([]string, error) {
+	if accounts.impersonation.PerformImpersonation() || accounts.clientIdentity != nil || len(accounts.signedURLPrincipal) > 0 {
+		return nil, nil
+	}
+
+	return GetAppRolesFromToken(accounts.token)
+}
+
+// GetTokenExpirationTime get the exp claim of the user token, or nil if the token has no exp claim
+func (accounts Accounts) GetTokenExpirationTime() (*time.Time, error) {
+	claims, err := parseUnverifiedClaims(accounts.token)
+	if err != nil {
+		return nil, err
+	}
+	return numericDateToTime(claims.GetExpirationTime())
+}
+
+// GetTokenIssuedAt get the iat claim of the user token, or nil if the token has no iat claim
+func (accounts Accounts) GetTokenIssuedAt() (*time.Time, error) {
+	claims, err := parseUnverifiedClaims(accounts.token)
+	if err != nil {
+		return nil, err
+	}
+	return numericDateToTime(claims.GetIssuedAt())
+}
+
+// GetTokenRemainingLifetime get the duration until the user token expires. The duration is negative for expired tokens
+func (accounts Accounts) GetTokenRemainingLifetime(clock utils.Clock) (time.Duration, error) {
+	expirationTime, err := accounts.GetTokenExpirationTime()
+	if err != nil {
+		return 0, err
+	}
+	if expirationTime == nil {
+		return 0, ErrTokenHasNoExpirationTime
+	}
+	return expirationTime.Sub(clock.Now()), nil
+}
+
+// ValidateTokenLifetime validates the exp, nbf and iat claims of the user token, allowing leeway for clock skew.
+// Claims that are not present in the token are not validated.
+// The JWT signature is not validated, that is left to the Kubernetes API
+func (accounts Accounts) ValidateTokenLifetime(clock utils.Clock, leeway time.Duration) error {
+	claims, err := parseUnverifiedClaims(accounts.token)
+	if err != nil {
+		return err
+	}
+
+	validator := jwt.NewValidator(jwt.WithTimeFunc(clock.Now), jwt.WithLeeway(leeway), jwt.WithIssuedAt())
+	return validator.Validate(claims)
+}
+
 // GetUserPrincipleNameFromToken reads the upn claim value from a token
 // The JWT signature is not validated, so ensure that the token signature is valid before using this function
 func GetUserPrincipleNameFromToken(token string) (string, error) {
@@ -51,3 +253,54 @@ func GetUserPrincipleNameFromToken(token string) (string, error) {
 	userPrincipleName := fmt.Sprintf("%v", claims["upn"])
 	return userPrincipleName, nil
 }
+
+// GetGroupsFromToken reads the groups claim value from a token
+// The JWT signature is not validated, so ensure that the token signature is valid before using this function
+func GetGroupsFromToken(token string) ([]string, error) {
+	return getStringsClaimFromToken(token, "groups")
+}
+
+// GetAppRolesFromToken reads the roles claim value from a token
+// The JWT signature is not validated, so ensure that the token signature is valid before using this function
+func GetAppRolesFromToken(token string) ([]string, error) {
+	return getStringsClaimFromToken(token, "roles")
+}
+
+func getStringsClaimFromToken(token, name string) ([]string, error) {
+	claims, err := parseUnverifiedClaims(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return stringsClaim(claims, name), nil
+}
+
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	rawValues, ok := claims[name].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	values := make([]string, 0, len(rawValues))
+	for _, value := range rawValues {
+		values = append(values, fmt.Sprintf("%v", value))
+	}
+	return values
+}
+
+func parseUnverifiedClaims(token string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser()
+
+	if _, _, err := parser.ParseUnverified(token, claims); err != nil {
+		return nil, fmt.Errorf("could not parse token (%v)", err)
+	}
+	return claims, nil
+}
+
+func numericDateToTime(date *jwt.NumericDate, err error) (*time.Time, error) {
+	if err != nil || date == nil {
+		return nil, err
+	}
+	return &date.Time, nil
+}
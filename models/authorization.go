@@ -0,0 +1,62 @@
+package models
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Authorizer Decides if the accounts are allowed to perform the request.
+// Returns false when access is denied, and an error when the decision could not be made
+type Authorizer interface {
+	Authorize(r *http.Request, accounts Accounts) (bool, error)
+}
+
+// AuthorizerFunc Function adapter for Authorizer
+type AuthorizerFunc func(r *http.Request, accounts Accounts) (bool, error)
+
+// Authorize Calls f(r, accounts)
+func (f AuthorizerFunc) Authorize(r *http.Request, accounts Accounts) (bool, error) {
+	return f(r, accounts)
+}
+
+// RequireGroups Requires the authenticated caller to be member of at least one of the groups.
+// Groups are read from a verified token, see net.WithTokenVerifier, or from a client certificate.
+// Impersonated groups are not used, and callers without verified groups are denied
+func RequireGroups(groups ...string) Authorizer {
+	return AuthorizerFunc(func(_ *http.Request, accounts Accounts) (bool, error) {
+		userGroups, ok := accounts.GetAuthenticatedGroups()
+		if !ok {
+			return false, nil
+		}
+		return containsAny(userGroups, groups), nil
+	})
+}
+
+// RequireAppRoles Requires the authenticated caller to have at least one of the app roles.
+// App roles are read from a verified token, see net.WithTokenVerifier, and callers without verified app roles are denied
+func RequireAppRoles(roles ...string) Authorizer {
+	return AuthorizerFunc(func(_ *http.Request, accounts Accounts) (bool, error) {
+		userRoles, ok := accounts.GetAuthenticatedAppRoles()
+		if !ok {
+			return false, nil
+		}
+		return containsAny(userRoles, roles), nil
+	})
+}
+
+// Require Requires the predicate to return true for the accounts.
+// The predicate must not trust unverified token claims or impersonation, e.g. from GetGroups
+func Require(predicate func(Accounts) bool) Authorizer {
+	return AuthorizerFunc(func(_ *http.Request, accounts Accounts) (bool, error) {
+		return predicate(accounts), nil
+	})
+}
+
+func containsAny(values, candidates []string) bool {
+	for _, candidate := range candidates {
+		if slices.Contains(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Authorizers(t *testing.T) {
+	claims := jwt.MapClaims{
+		"upn":    "radix@equinor.com",
+		"groups": []interface{}{"group1", "group2"},
+		"roles":  []interface{}{"Radix.Admin"},
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("any-key"))
+	accounts := NewAccounts(token, Impersonation{}).WithVerifiedClaims(claims)
+	impersonation, _ := NewImpersonation("other-user", []string{"group3"})
+	impersonatedAccounts := NewAccounts(token, impersonation).WithVerifiedClaims(claims)
+	req := &http.Request{}
+
+	allowed, err := RequireGroups("group2", "group3").Authorize(req, accounts)
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, _ = RequireGroups("group3").Authorize(req, accounts)
+	assert.False(t, allowed)
+
+	allowed, _ = RequireGroups("group3").Authorize(req, impersonatedAccounts)
+	assert.False(t, allowed, "Impersonated groups are not used")
+
+	allowed, _ = RequireGroups("group1").Authorize(req, impersonatedAccounts)
+	assert.True(t, allowed, "Groups of the authenticated caller are used when impersonating")
+
+	allowed, _ = RequireAppRoles("Radix.Admin").Authorize(req, accounts)
+	assert.True(t, allowed)
+
+	allowed, _ = RequireGroups("group1").Authorize(req, NewAccounts(token, Impersonation{}))
+	assert.False(t, allowed, "Groups of unverified tokens are not used")
+
+	allowed, _ = RequireAppRoles("Radix.Admin").Authorize(req, NewAccounts(token, Impersonation{}))
+	assert.False(t, allowed, "App roles of unverified tokens are not used")
+
+	allowed, _ = RequireGroups("group1").Authorize(req, NewClientCertificateAccounts(ClientIdentity{Principal: "radix-operator", Groups: []string{"group1"}}))
+	assert.True(t, allowed, "Groups of client certificates are verified")
+
+	allowed, _ = Require(func(a Accounts) bool { return a.GetImpersonation().PerformImpersonation() }).Authorize(req, impersonatedAccounts)
+	assert.True(t, allowed)
+}
+
+func Test_JWTTokenVerifier(t *testing.T) {
+	sut := JWTTokenVerifier(func(*jwt.Token) (interface{}, error) { return []byte("trusted-key"), nil }, jwt.WithValidMethods([]string{"HS256"}))
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"upn": "radix@equinor.com"}).SignedString([]byte("trusted-key"))
+	claims, err := sut(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, "radix@equinor.com", claims["upn"])
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"upn": "radix@equinor.com"}).SignedString([]byte("any-key"))
+	_, err = sut(context.Background(), forged)
+	assert.Error(t, err)
+}
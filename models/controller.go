@@ -1,6 +1,9 @@
 package models
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 // Controller Pattern of an rest/stream controller
 type Controller interface {
@@ -14,11 +17,97 @@ type DefaultController struct {
 // Routes Holder of all routes
 type Routes []Route
 
+// AuthenticationMode Describes how requests to a route are authenticated
+type AuthenticationMode int
+
+const (
+	// AuthenticationRequired Requests without valid credentials are rejected. This is the default
+	AuthenticationRequired AuthenticationMode = iota
+	// AuthenticationOptional Credentials are validated when present, but requests without credentials are allowed
+	AuthenticationOptional
+	// AuthenticationAnonymous Credentials are ignored, e.g. for health and public endpoints
+	AuthenticationAnonymous
+)
+
+// RateLimit Token bucket rate limit
+type RateLimit struct {
+	// RequestsPerSecond Rate the bucket is refilled with
+	RequestsPerSecond float64
+	// Burst Size of the bucket, i.e. the number of requests allowed in a burst
+	Burst int
+}
+
+// Deprecation Marks a route as deprecated, announced with the Deprecation, Sunset, Link and Warning response headers
+type Deprecation struct {
+	// Date When the route was deprecated. The Deprecation header is true when the date is not set
+	Date time.Time
+	// Sunset When the route is expected to be removed. Optional
+	Sunset time.Time
+	// Replacement URL of the route replacing the deprecated route, linked with rel="successor-version". Optional
+	Replacement string
+	// Message Text of the Warning header. Defaults to a message built from the replacement and sunset
+	Message string
+}
+
 // Route Describe route
 type Route struct {
-	Path        string
-	Method      string
-	HandlerFunc RadixHandlerFunc
+	Path           string
+	Method         string
+	HandlerFunc    RadixHandlerFunc
+	Authentication AuthenticationMode
+	// Authorization Requirements that must all be met by the authenticated accounts
+	Authorization []Authorizer
+	// RateLimit Rate limit per principal for this route, replacing the default rate limit
+	RateLimit *RateLimit
+	// Streaming Long-lived route, e.g. server-sent events or log follow.
+	// Streaming routes are excluded from the default concurrency limit and the default timeout
+	Streaming bool
+	// ConcurrencyPool Name of the concurrency limiter pool the route is counted in, instead of the default pool.
+	// Routes in a pool that is not configured are not limited
+	ConcurrencyPool string
+	// ReadOnly The route does not change state although the method is not safe, e.g. a search with POST.
+	// Read-only routes are let through during maintenance windows
+	ReadOnly bool
+	// SignedURL Accepts URLs signed by the URL signer of the router as authentication, e.g. for download and stream routes
+	SignedURL bool
+	// Timeout Time allowed for the handler, replacing the default timeout. A negative timeout disables the timeout
+	Timeout time.Duration
+	// Middlewares Wrap the handler in order, after the request is authenticated and authorized
+	Middlewares []Middleware
+	// Docs Optional description of the route for the OpenAPI document
+	Docs *RouteDocs
+	// Deprecation Marks the route as deprecated
+	Deprecation *Deprecation
+}
+
+// RouteDocs Description of a route for the OpenAPI document.
+// Request and Response are values of the body types, e.g. MyRequest{} or []MyResponse{}, and are described by reflection
+type RouteDocs struct {
+	OperationID string
+	Summary     string
+	Description string
+	Tags        []string
+	// Parameters Descriptions of path, query and header parameters. Path parameters not listed are documented as strings
+	Parameters []ParameterDoc
+	// Request Value of the request body type, or nil when the route has no request body
+	Request any
+	// Response Value of the response body type, or nil when the route has no response body
+	Response any
+	// ResponseStatus Status code of successful responses. Defaults to 200 OK
+	ResponseStatus int
+	// ErrorTypes Types of net/http.Error the route can return, e.g. "missing" or "forbidden"
+	ErrorTypes []string
+}
+
+// ParameterDoc Description of a route parameter
+type ParameterDoc struct {
+	Name string
+	// In Location of the parameter, "path", "query" or "header". Defaults to "path" for path parameters, otherwise "query"
+	In          string
+	Description string
+	Required    bool
+	// Type Value of the parameter type, e.g. 0 or true. Defaults to string
+	Type any
 }
 
 // RadixHandlerFunc Pattern for handler functions
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+// Middleware Wraps a RadixHandlerFunc, e.g. to audit, time or instrument requests
+type Middleware func(RadixHandlerFunc) RadixHandlerFunc
+
+// MiddlewareChain Ordered list of middlewares. The first middleware is the outermost, and runs first
+type MiddlewareChain []Middleware
+
+// NewMiddlewareChain Constructor for MiddlewareChain
+func NewMiddlewareChain(middlewares ...Middleware) MiddlewareChain {
+	return slices.Clone(middlewares)
+}
+
+// Append Returns a new chain with the middlewares added after the middlewares of this chain
+func (chain MiddlewareChain) Append(middlewares ...Middleware) MiddlewareChain {
+	return append(slices.Clone(chain), middlewares...)
+}
+
+// Then Wraps the handler in the middlewares of the chain
+func (chain MiddlewareChain) Then(handler RadixHandlerFunc) RadixHandlerFunc {
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	return handler
+}
+
+// MiddlewareController Controller with middlewares that wrap the handlers of all its routes
+type MiddlewareController interface {
+	Controller
+	GetMiddlewares() []Middleware
+}
+
+// ControllerRoutes The routes of the controller. When the controller is a MiddlewareController,
+// its middlewares are added before the middlewares of each route
+func ControllerRoutes(controller Controller) Routes {
+	routes := controller.GetRoutes()
+	withMiddlewares, ok := controller.(MiddlewareController)
+	if !ok {
+		return routes
+	}
+	return withRouteMiddlewares(routes, withMiddlewares.GetMiddlewares())
+}
+
+// RouteGroup Routes and controllers sharing a path prefix and middlewares.
+// A RouteGroup is a Controller, so groups can be nested and registered like controllers
+type RouteGroup struct {
+	// Prefix Path prefix of the routes, e.g. /api/v1
+	Prefix string
+	// Middlewares Middlewares added before the middlewares of each route in the group
+	Middlewares []Middleware
+	Routes      Routes
+	Controllers []Controller
+}
+
+// GetRoutes The routes and the routes of the controllers in the group, with the prefix and middlewares of the group
+func (group RouteGroup) GetRoutes() Routes {
+	routes := slices.Clone(group.Routes)
+	for _, controller := range group.Controllers {
+		routes = append(routes, ControllerRoutes(controller)...)
+	}
+	routes = withRouteMiddlewares(routes, group.Middlewares)
+	for i := range routes {
+		routes[i].Path = joinPath(group.Prefix, routes[i].Path)
+	}
+	return routes
+}
+
+func withRouteMiddlewares(routes Routes, middlewares []Middleware) Routes {
+	result := make(Routes, 0, len(routes))
+	for _, route := range routes {
+		route.Middlewares = NewMiddlewareChain(middlewares...).Append(route.Middlewares...)
+		result = append(result, route)
+	}
+	return result
+}
+
+func joinPath(prefix, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if len(path) == 0 {
+		return prefix
+	}
+	return prefix + "/" + strings.TrimPrefix(path, "/")
+}
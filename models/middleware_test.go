@@ -0,0 +1,78 @@
+package models
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type middlewareTestController struct {
+	routes      Routes
+	middlewares []Middleware
+}
+
+func (c middlewareTestController) GetRoutes() Routes {
+	return c.routes
+}
+
+func (c middlewareTestController) GetMiddlewares() []Middleware {
+	return c.middlewares
+}
+
+func tracingMiddleware(trace *[]string, name string) Middleware {
+	return func(next RadixHandlerFunc) RadixHandlerFunc {
+		return func(accounts Accounts, w http.ResponseWriter, r *http.Request) {
+			*trace = append(*trace, name)
+			next(accounts, w, r)
+		}
+	}
+}
+
+func Test_MiddlewareChain(t *testing.T) {
+	var trace []string
+	base := NewMiddlewareChain(tracingMiddleware(&trace, "first"))
+	chain := base.Append(tracingMiddleware(&trace, "second"), tracingMiddleware(&trace, "third"))
+
+	chain.Then(func(Accounts, http.ResponseWriter, *http.Request) {
+		trace = append(trace, "handler")
+	})(Accounts{}, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/any", nil))
+
+	assert.Equal(t, []string{"first", "second", "third", "handler"}, trace)
+	assert.Len(t, base, 1, "Append does not change the chain")
+}
+
+func Test_RouteGroup_GetRoutes(t *testing.T) {
+	var trace []string
+	controller := middlewareTestController{
+		routes:      Routes{{Path: "/jobs", Middlewares: []Middleware{tracingMiddleware(&trace, "route")}}},
+		middlewares: []Middleware{tracingMiddleware(&trace, "controller")},
+	}
+	group := RouteGroup{
+		Prefix:      "/api/v1/",
+		Middlewares: []Middleware{tracingMiddleware(&trace, "group")},
+		Routes:      Routes{{Path: "/"}, {Path: "applications/{appName}"}},
+		Controllers: []Controller{controller},
+	}
+	outer := RouteGroup{
+		Prefix:      "/radix",
+		Middlewares: []Middleware{tracingMiddleware(&trace, "outer")},
+		Controllers: []Controller{group},
+	}
+
+	routes := outer.GetRoutes()
+	var paths []string
+	for _, route := range routes {
+		paths = append(paths, route.Path)
+	}
+	assert.Equal(t, []string{"/radix/api/v1/", "/radix/api/v1/applications/{appName}", "/radix/api/v1/jobs"}, paths)
+
+	NewMiddlewareChain(routes[2].Middlewares...).Then(func(Accounts, http.ResponseWriter, *http.Request) {
+		trace = append(trace, "handler")
+	})(Accounts{}, httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Equal(t, []string{"outer", "group", "controller", "route", "handler"}, trace)
+
+	assert.Len(t, controller.routes[0].Middlewares, 1, "Routes of the controller are not changed")
+	assert.Equal(t, "/jobs", controller.routes[0].Path)
+}
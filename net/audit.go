@@ -0,0 +1,365 @@
+package net
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	"github.com/equinor/radix-common/utils"
+	"github.com/rs/zerolog"
+)
+
+const (
+	redactedValue         = "[REDACTED]"
+	defaultAuditQueueSize = 1000
+)
+
+// DefaultAuditRedactedFields Names of path and query parameters with secret values, redacted in audit events
+var DefaultAuditRedactedFields = []string{"password", "secret", "token", "access_token", "refresh_token", "client_secret", "api_key", "apikey"}
+
+// AuditEvent Record of a request that changed something
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId,omitempty"`
+	// Principal The verified principal of the caller, see models.Accounts.GetAuthenticatedPrincipal
+	Principal string `json:"principal,omitempty"`
+	// UnverifiedPrincipal The principal claimed by a bearer token that is not verified, see WithTokenVerifier.
+	// Anyone can sign a token with any principal, so the caller is not known to be this principal
+	UnverifiedPrincipal string              `json:"unverifiedPrincipal,omitempty"`
+	ImpersonatedUser    string              `json:"impersonatedUser,omitempty"`
+	ImpersonatedGroups  []string            `json:"impersonatedGroups,omitempty"`
+	Method              string              `json:"method"`
+	Route               string              `json:"route"`
+	Path                string              `json:"path"`
+	PathParams          map[string]string   `json:"pathParams,omitempty"`
+	Query               map[string][]string `json:"query,omitempty"`
+	// Status The status of the response, or 500 when the handler panicked before writing a response
+	Status int `json:"status"`
+	// BodySHA256 Hex encoded SHA-256 digest of the part of the request body read by the handler, or empty when the request has no body
+	BodySHA256 string `json:"bodySha256,omitempty"`
+	// BodyDigestPartial The handler did not read the whole body, so BodySHA256 covers only the part that was read
+	BodyDigestPartial bool          `json:"bodyDigestPartial,omitempty"`
+	Duration          time.Duration `json:"duration"`
+}
+
+// AuditSink Destination of audit events
+type AuditSink interface {
+	WriteAuditEvent(event AuditEvent) error
+}
+
+// AuditOption Option for the Auditor
+type AuditOption func(*Auditor)
+
+type auditRecord struct {
+	event  AuditEvent
+	logger *zerolog.Logger
+}
+
+// Auditor Records audit events of requests to a sink. Events are written in the background,
+// so a slow or failing sink does not block requests. Events are dropped, and the drop is logged,
+// when the queue is full
+type Auditor struct {
+	sink           AuditSink
+	clock          utils.Clock
+	methods        []string
+	redactedFields []string
+	queueSize      int
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan auditRecord
+	done   chan struct{}
+}
+
+// WithAuditMethods Methods of the requests that are audited. Defaults to POST, PUT, PATCH and DELETE
+func WithAuditMethods(methods ...string) AuditOption {
+	return func(auditor *Auditor) {
+		auditor.methods = methods
+	}
+}
+
+// WithAuditRedactedFields Names of path and query parameters with secret values, matched case-insensitively.
+// Replaces DefaultAuditRedactedFields
+func WithAuditRedactedFields(names ...string) AuditOption {
+	return func(auditor *Auditor) {
+		auditor.redactedFields = names
+	}
+}
+
+// WithAuditQueueSize Number of events waiting to be written before events are dropped
+func WithAuditQueueSize(size int) AuditOption {
+	return func(auditor *Auditor) {
+		auditor.queueSize = size
+	}
+}
+
+// WithAuditClock Clock used for the time of the events
+func WithAuditClock(clock utils.Clock) AuditOption {
+	return func(auditor *Auditor) {
+		auditor.clock = clock
+	}
+}
+
+// NewAuditor Constructor for Auditor. Close must be called to write queued events before the program exits
+func NewAuditor(sink AuditSink, options ...AuditOption) *Auditor {
+	auditor := &Auditor{
+		sink:           sink,
+		clock:          utils.RealClock{},
+		methods:        []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		redactedFields: DefaultAuditRedactedFields,
+		queueSize:      defaultAuditQueueSize,
+		done:           make(chan struct{}),
+	}
+	for _, option := range options {
+		option(auditor)
+	}
+	auditor.queue = make(chan auditRecord, auditor.queueSize)
+	go auditor.run()
+	return auditor
+}
+
+// Middleware Records an audit event for each request with an audited method,
+// with the verified principal and impersonation of the accounts, the route and its path parameters, the status and a digest of the body
+func (auditor *Auditor) Middleware() models.Middleware {
+	return func(next models.RadixHandlerFunc) models.RadixHandlerFunc {
+		return func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(auditor.methods, r.Method) {
+				next(accounts, w, r)
+				return
+			}
+
+			startTime := auditor.clock.Now()
+			recorder := NewResponseRecorder(w)
+			var body *digestReader
+			if r.Body != nil && r.Body != http.NoBody {
+				body = &digestReader{ReadCloser: r.Body, hash: sha256.New()}
+				r.Body = body
+			}
+
+			// The event is recorded when the handler panics, before the panic is recovered
+			completed := false
+			defer func() {
+				event := auditor.newEvent(accounts, r)
+				event.Time = startTime
+				event.Duration = auditor.clock.Now().Sub(startTime)
+				event.Status = recorder.Status()
+				if !completed && event.Status == 0 {
+					event.Status = http.StatusInternalServerError
+				}
+				if body != nil {
+					event.BodySHA256, event.BodyDigestPartial = body.digest()
+				}
+				auditor.enqueue(event, zerolog.Ctx(r.Context()))
+			}()
+
+			next(accounts, recorder, r)
+			completed = true
+		}
+	}
+}
+
+// Close Stops accepting events, and waits until the queued events are written
+func (auditor *Auditor) Close() {
+	auditor.mu.Lock()
+	if !auditor.closed {
+		auditor.closed = true
+		close(auditor.queue)
+	}
+	auditor.mu.Unlock()
+	<-auditor.done
+}
+
+func (auditor *Auditor) newEvent(accounts models.Accounts, r *http.Request) AuditEvent {
+	impersonation := accounts.GetImpersonation()
+	event := AuditEvent{
+		ImpersonatedUser:   impersonation.User,
+		ImpersonatedGroups: impersonation.Groups,
+		Method:             r.Method,
+		Route:              r.Pattern,
+		Path:               r.URL.Path,
+	}
+	if principal, ok := accounts.GetAuthenticatedPrincipal(); ok {
+		event.Principal = principal
+	} else {
+		event.UnverifiedPrincipal = accounts.GetPrincipal()
+	}
+	if tc, ok := TraceContextFromContext(r.Context()); ok {
+		event.RequestID = tc.RequestID
+	}
+	if len(event.Route) == 0 {
+		event.Route = r.URL.Path
+	}
+
+	if i := strings.IndexByte(r.Pattern, '/'); i >= 0 {
+		_, names := openAPIPath(r.Pattern[i:])
+		for _, name := range names {
+			if event.PathParams == nil {
+				event.PathParams = map[string]string{}
+			}
+			event.PathParams[name] = auditor.redact(name, r.PathValue(name))
+		}
+	}
+
+	for name, values := range r.URL.Query() {
+		if event.Query == nil {
+			event.Query = map[string][]string{}
+		}
+		for _, value := range values {
+			event.Query[name] = append(event.Query[name], auditor.redact(name, value))
+		}
+	}
+	return event
+}
+
+func (auditor *Auditor) redact(name, value string) string {
+	if slices.ContainsFunc(auditor.redactedFields, func(field string) bool { return strings.EqualFold(field, name) }) {
+		return redactedValue
+	}
+	return value
+}
+
+func (auditor *Auditor) enqueue(event AuditEvent, logger *zerolog.Logger) {
+	auditor.mu.RLock()
+	defer auditor.mu.RUnlock()
+	if auditor.closed {
+		logger.Error().Str("route", event.Route).Msg("auditor is closed, audit event is dropped")
+		return
+	}
+	select {
+	case auditor.queue <- auditRecord{event: event, logger: logger}:
+	default:
+		logger.Error().Str("route", event.Route).Msg("audit queue is full, audit event is dropped")
+	}
+}
+
+func (auditor *Auditor) run() {
+	defer close(auditor.done)
+	for record := range auditor.queue {
+		if err := auditor.sink.WriteAuditEvent(record.event); err != nil {
+			record.logger.Error().Err(err).Str("route", record.event.Route).Msg("unable to write audit event")
+		}
+	}
+}
+
+// digestReader Computes the digest of the body read by the handler
+// digestReader Hashes the body read by the handler. A handler that overran the timeout can still read the body
+// while the event is recorded, so the hash is guarded by a mutex
+type digestReader struct {
+	io.ReadCloser
+	mu   sync.Mutex
+	hash hash.Hash
+	eof  bool
+}
+
+func (reader *digestReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	reader.hash.Write(p[:n])
+	if err == io.EOF {
+		reader.eof = true
+	}
+	return n, err
+}
+
+// digest The digest of the part of the body read by the handler, and whether the body was not read to the end.
+// The rest of the body is not read, so a large or slow body does not block the request
+func (reader *digestReader) digest() (string, bool) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+	return hex.EncodeToString(reader.hash.Sum(nil)), !reader.eof
+}
+
+// ZerologAuditSink Writes audit events as zerolog info messages
+type ZerologAuditSink struct {
+	logger zerolog.Logger
+}
+
+// NewZerologAuditSink Constructor for ZerologAuditSink
+func NewZerologAuditSink(logger zerolog.Logger) *ZerologAuditSink {
+	return &ZerologAuditSink{logger: logger}
+}
+
+// WriteAuditEvent Writes the event
+func (sink *ZerologAuditSink) WriteAuditEvent(event AuditEvent) error {
+	logEvent := sink.logger.Info().
+		Time("audit_time", event.Time).
+		Str("method", event.Method).
+		Str("route", event.Route).
+		Str("path", event.Path).
+		Int("status", event.Status).
+		Dur("duration", event.Duration)
+	if len(event.RequestID) > 0 {
+		logEvent.Str("request_id", event.RequestID)
+	}
+	if len(event.Principal) > 0 {
+		logEvent.Str("principal", event.Principal)
+	}
+	if len(event.UnverifiedPrincipal) > 0 {
+		logEvent.Str("unverified_principal", event.UnverifiedPrincipal)
+	}
+	if len(event.ImpersonatedUser) > 0 {
+		logEvent.Str("impersonated_user", event.ImpersonatedUser).Strs("impersonated_groups", event.ImpersonatedGroups)
+	}
+	if len(event.PathParams) > 0 {
+		logEvent.Interface("path_params", event.PathParams)
+	}
+	if len(event.Query) > 0 {
+		logEvent.Interface("query", event.Query)
+	}
+	if len(event.BodySHA256) > 0 {
+		logEvent.Str("body_sha256", event.BodySHA256).Bool("body_digest_partial", event.BodyDigestPartial)
+	}
+	logEvent.Msg("audit")
+	return nil
+}
+
+// JSONLinesAuditSink Writes audit events as JSON, one event per line
+type JSONLinesAuditSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewJSONLinesAuditSink Constructor for JSONLinesAuditSink writing to w
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: w}
+}
+
+// OpenJSONLinesAuditFile Opens a JSONLinesAuditSink appending to the file, creating the file when it does not exist
+func OpenJSONLinesAuditFile(name string) (*JSONLinesAuditSink, error) {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditSink{w: file, closer: file}, nil
+}
+
+// WriteAuditEvent Writes the event as a line of JSON
+func (sink *JSONLinesAuditSink) WriteAuditEvent(event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	_, err = sink.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close Closes the file of a sink opened with OpenJSONLinesAuditFile
+func (sink *JSONLinesAuditSink) Close() error {
+	if sink.closer == nil {
+		return nil
+	}
+	return sink.closer.Close()
+}
@@ -0,0 +1,242 @@
+package net
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type auditSinkFunc func(event AuditEvent) error
+
+func (f auditSinkFunc) WriteAuditEvent(event AuditEvent) error {
+	return f(event)
+}
+
+func newAuditTestRouter(auditor *Auditor, options ...RadixMiddlewareOption) *Router {
+	return NewRouter(nil, append(options, WithMiddlewares(auditor.Middleware()))...).AddRoutes(models.Routes{
+		{
+			Path:   "/applications/{appName}/secrets/{secret}",
+			Method: http.MethodPut,
+			HandlerFunc: func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+				_, _ = io.ReadAll(io.LimitReader(r.Body, 2))
+				w.WriteHeader(http.StatusAccepted)
+			},
+		},
+		{
+			Path:           "/applications/{appName}/restart",
+			Method:         http.MethodPost,
+			Authentication: models.AuthenticationAnonymous,
+			HandlerFunc: func(models.Accounts, http.ResponseWriter, *http.Request) {
+				panic("any panic")
+			},
+		},
+		{
+			Path:   "/applications/{appName}",
+			Method: http.MethodGet,
+			HandlerFunc: func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+				_ = httpUtils.StringResponse(w, r, "ok")
+			},
+		},
+	})
+}
+
+func Test_Auditor_RecordsMutatingRequests(t *testing.T) {
+	events := make(chan AuditEvent, 10)
+	auditor := NewAuditor(auditSinkFunc(func(event AuditEvent) error {
+		events <- event
+		return nil
+	}))
+	verifier := models.JWTTokenVerifier(func(*jwt.Token) (interface{}, error) { return []byte("any-key"), nil }, jwt.WithValidMethods([]string{"HS256"}))
+	sut := newAuditTestRouter(auditor, WithTokenVerifier(verifier))
+	token := newTestToken(t, jwt.MapClaims{"upn": "radix@equinor.com"})
+
+	body := `{"value":"any"}`
+	req := httptest.NewRequest(http.MethodPut, "/applications/any-app/secrets/db-password?token=abc&dryRun=true", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Impersonate-User", "other@equinor.com")
+	req.Header.Set("Impersonate-Group", "group1")
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/applications/any-app", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	sut.ServeHTTP(httptest.NewRecorder(), req)
+	auditor.Close()
+	close(events)
+
+	var actual []AuditEvent
+	for event := range events {
+		actual = append(actual, event)
+	}
+	require.Len(t, actual, 1, "Only mutating requests are audited")
+	event := actual[0]
+	digest := sha256.Sum256([]byte(body[:2]))
+	assert.Equal(t, "radix@equinor.com", event.Principal)
+	assert.Empty(t, event.UnverifiedPrincipal)
+	assert.Equal(t, "other@equinor.com", event.ImpersonatedUser)
+	assert.Equal(t, []string{"group1"}, event.ImpersonatedGroups)
+	assert.Equal(t, http.MethodPut, event.Method)
+	assert.Equal(t, "PUT /applications/{appName}/secrets/{secret}", event.Route)
+	assert.Equal(t, "/applications/any-app/secrets/db-password", event.Path)
+	assert.Equal(t, map[string]string{"appName": "any-app", "secret": "[REDACTED]"}, event.PathParams)
+	assert.Equal(t, map[string][]string{"token": {"[REDACTED]"}, "dryRun": {"true"}}, event.Query)
+	assert.Equal(t, http.StatusAccepted, event.Status)
+	assert.Equal(t, hex.EncodeToString(digest[:]), event.BodySHA256, "The digest covers the part of the body read by the handler")
+	assert.True(t, event.BodyDigestPartial)
+	assert.False(t, event.Time.IsZero())
+}
+
+func Test_Auditor_UnverifiedPrincipal(t *testing.T) {
+	events := make(chan AuditEvent, 10)
+	auditor := NewAuditor(auditSinkFunc(func(event AuditEvent) error {
+		events <- event
+		return nil
+	}))
+	sut := newAuditTestRouter(auditor)
+
+	req := httptest.NewRequest(http.MethodPut, "/applications/any-app/secrets/any", nil)
+	req.Header.Set("Authorization", "Bearer "+newTestToken(t, jwt.MapClaims{"upn": "admin@equinor.com"}))
+	sut.ServeHTTP(httptest.NewRecorder(), req)
+	auditor.Close()
+
+	event := <-events
+	assert.Empty(t, event.Principal, "Claims of unverified tokens are not audited as the principal")
+	assert.Equal(t, "admin@equinor.com", event.UnverifiedPrincipal)
+}
+
+func Test_Auditor_RecordsPanickingRequests(t *testing.T) {
+	events := make(chan AuditEvent, 10)
+	auditor := NewAuditor(auditSinkFunc(func(event AuditEvent) error {
+		events <- event
+		return nil
+	}))
+	sut := newAuditTestRouter(auditor, WithPanicRecovery())
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/applications/any-app/restart", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	auditor.Close()
+
+	event := <-events
+	assert.Equal(t, "POST /applications/{appName}/restart", event.Route)
+	assert.Equal(t, http.StatusInternalServerError, event.Status)
+}
+
+func Test_Auditor_BodyDigest(t *testing.T) {
+	events := make(chan AuditEvent, 10)
+	auditor := NewAuditor(auditSinkFunc(func(event AuditEvent) error {
+		events <- event
+		return nil
+	}))
+	sut := NewRouter(nil, WithMiddlewares(auditor.Middleware())).AddRoutes(models.Routes{{
+		Path:           "/jobs",
+		Method:         http.MethodPost,
+		Authentication: models.AuthenticationAnonymous,
+		HandlerFunc: func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+		},
+	}})
+
+	body := `{"name":"any"}`
+	sut.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(body)))
+	auditor.Close()
+
+	event := <-events
+	digest := sha256.Sum256([]byte(body))
+	assert.Equal(t, hex.EncodeToString(digest[:]), event.BodySHA256)
+	assert.False(t, event.BodyDigestPartial)
+}
+
+func Test_Auditor_BodyReadAfterTimeout(t *testing.T) {
+	events := make(chan AuditEvent, 10)
+	auditor := NewAuditor(auditSinkFunc(func(event AuditEvent) error {
+		events <- event
+		return nil
+	}))
+	handlerDone := make(chan struct{})
+	handler := func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		defer close(handlerDone)
+		<-r.Context().Done()
+		_, _ = io.ReadAll(r.Body)
+	}
+	sut := NewRouter(nil, WithTimeout(10*time.Millisecond), WithMiddlewares(auditor.Middleware())).AddRoutes(models.Routes{
+		{Path: "/jobs", Method: http.MethodPost, Authentication: models.AuthenticationAnonymous, HandlerFunc: handler},
+	})
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	<-handlerDone
+	auditor.Close()
+	assert.Equal(t, http.StatusGatewayTimeout, (<-events).Status)
+}
+
+func Test_Auditor_DoesNotBlockRequests(t *testing.T) {
+	release := make(chan struct{})
+	written := make(chan struct{}, 10)
+	auditor := NewAuditor(auditSinkFunc(func(AuditEvent) error {
+		<-release
+		written <- struct{}{}
+		return errors.New("any error")
+	}), WithAuditQueueSize(1))
+	sut := newAuditTestRouter(auditor)
+	token := newTestToken(t, jwt.MapClaims{"upn": "radix@equinor.com"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			req := httptest.NewRequest(http.MethodPut, "/applications/any-app/secrets/any", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			sut.ServeHTTP(httptest.NewRecorder(), req)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "requests are blocked by the audit sink")
+	}
+
+	close(release)
+	auditor.Close()
+	assert.LessOrEqual(t, len(written), 2, "Events are dropped when the queue is full")
+}
+
+func Test_JSONLinesAuditFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := OpenJSONLinesAuditFile(name)
+	require.NoError(t, err)
+	require.NoError(t, sink.WriteAuditEvent(AuditEvent{Method: http.MethodPost, Route: "/first", Status: http.StatusOK}))
+	require.NoError(t, sink.WriteAuditEvent(AuditEvent{Method: http.MethodDelete, Route: "/second", Status: http.StatusNotFound}))
+	require.NoError(t, sink.Close())
+
+	file, err := os.Open(name)
+	require.NoError(t, err)
+	defer file.Close()
+	var routes []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event AuditEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		routes = append(routes, event.Route)
+	}
+	assert.Equal(t, []string{"/first", "/second"}, routes)
+}
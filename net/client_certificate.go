@@ -0,0 +1,139 @@
+package net
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/equinor/radix-common/models"
+	"github.com/equinor/radix-common/utils"
+)
+
+// ErrNoClientPrincipal The client certificate could not be mapped to a principal
+var ErrNoClientPrincipal = errors.New("no principal in client certificate")
+
+// PrincipalMapper Maps a verified client certificate to a principal. Returns false when the certificate has no matching identity
+type PrincipalMapper func(cert *x509.Certificate) (string, bool)
+
+// PrincipalFromSPIFFEID Maps the SPIFFE ID in the URI SANs, e.g. spiffe://radix/ns/radix-system/sa/radix-operator
+func PrincipalFromSPIFFEID(cert *x509.Certificate) (string, bool) {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" && len(uri.Host) > 0 {
+			return uri.String(), true
+		}
+	}
+	return "", false
+}
+
+// PrincipalFromDNSName Maps the first DNS name in the SANs
+func PrincipalFromDNSName(cert *x509.Certificate) (string, bool) {
+	if len(cert.DNSNames) == 0 {
+		return "", false
+	}
+	return cert.DNSNames[0], true
+}
+
+// PrincipalFromEmailAddress Maps the first email address in the SANs
+func PrincipalFromEmailAddress(cert *x509.Certificate) (string, bool) {
+	if len(cert.EmailAddresses) == 0 {
+		return "", false
+	}
+	return cert.EmailAddresses[0], true
+}
+
+// PrincipalFromCommonName Maps the common name of the subject
+func PrincipalFromCommonName(cert *x509.Certificate) (string, bool) {
+	return cert.Subject.CommonName, len(cert.Subject.CommonName) > 0
+}
+
+// FirstPrincipal Maps the certificate with the first mapper returning a principal
+func FirstPrincipal(mappers ...PrincipalMapper) PrincipalMapper {
+	return func(cert *x509.Certificate) (string, bool) {
+		for _, mapper := range mappers {
+			if principal, ok := mapper(cert); ok {
+				return principal, true
+			}
+		}
+		return "", false
+	}
+}
+
+// ClientCertificateOption Option for ClientCertificateAuthenticator
+type ClientCertificateOption func(*ClientCertificateAuthenticator)
+
+// WithPrincipalMapper Sets how certificates are mapped to a principal.
+// Defaults to the SPIFFE ID, or the subject common name when the certificate has no SPIFFE ID
+func WithPrincipalMapper(mapper PrincipalMapper) ClientCertificateOption {
+	return func(authenticator *ClientCertificateAuthenticator) {
+		authenticator.principal = mapper
+	}
+}
+
+// WithClientCertificateClock Clock used to validate the lifetime of the certificates
+func WithClientCertificateClock(clock utils.Clock) ClientCertificateOption {
+	return func(authenticator *ClientCertificateAuthenticator) {
+		authenticator.clock = clock
+	}
+}
+
+// ClientCertificateAuthenticator Authenticates callers with TLS client certificates, verified against a CA pool.
+// The certificate is mapped to a principal, and the subject organizations are the groups of the caller, like in Kubernetes
+type ClientCertificateAuthenticator struct {
+	roots     *x509.CertPool
+	principal PrincipalMapper
+	clock     utils.Clock
+}
+
+// NewClientCertificateAuthenticator Constructor for ClientCertificateAuthenticator, trusting client certificates issued by the roots
+func NewClientCertificateAuthenticator(roots *x509.CertPool, options ...ClientCertificateOption) *ClientCertificateAuthenticator {
+	authenticator := &ClientCertificateAuthenticator{
+		roots:     roots,
+		principal: FirstPrincipal(PrincipalFromSPIFFEID, PrincipalFromCommonName),
+		clock:     utils.RealClock{},
+	}
+	for _, option := range options {
+		option(authenticator)
+	}
+	return authenticator
+}
+
+// ConfigureServerTLS Makes the server request client certificates, without failing the handshake for missing or
+// untrusted certificates, so callers without certificates can use bearer tokens and invalid certificates are answered with 401 Unauthorized
+func (authenticator *ClientCertificateAuthenticator) ConfigureServerTLS(config *tls.Config) {
+	config.ClientAuth = tls.RequestClientCert
+}
+
+// Authenticate Verifies the client certificate of the request and maps it to Accounts.
+// Returns false when the request has no client certificate
+func (authenticator *ClientCertificateAuthenticator) Authenticate(r *http.Request) (models.Accounts, bool, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return models.Accounts{}, false, nil
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(intermediate)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         authenticator.roots,
+		Intermediates: intermediates,
+		CurrentTime:   authenticator.clock.Now(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return models.Accounts{}, true, fmt.Errorf("invalid client certificate: %w", err)
+	}
+
+	principal, ok := authenticator.principal(cert)
+	if !ok {
+		return models.Accounts{}, true, ErrNoClientPrincipal
+	}
+	return models.NewClientCertificateAccounts(models.ClientIdentity{
+		Principal:   principal,
+		Groups:      slices.Clone(cert.Subject.Organization),
+		Certificate: cert,
+	}), true, nil
+}
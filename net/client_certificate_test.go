@@ -0,0 +1,153 @@
+package net
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func Test_RadixMiddleware_ClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	authenticator := NewClientCertificateAuthenticator(ca.pool())
+	spiffeID, _ := url.Parse("spiffe://radix/ns/radix-system/sa/radix-operator")
+
+	server := httptest.NewUnstartedServer(NewRouter(nil, WithClientCertificateAuthenticator(authenticator)).AddRoutes(models.Routes{{
+		Path:   "/whoami",
+		Method: http.MethodGet,
+		HandlerFunc: func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+			groups, _ := accounts.GetGroups()
+			w.Header()["X-Groups"] = groups
+			_ = httpUtils.StringResponse(w, r, accounts.GetPrincipal())
+		},
+	}}))
+	server.TLS = &tls.Config{}
+	authenticator.ConfigureServerTLS(server.TLS)
+	server.StartTLS()
+	defer server.Close()
+
+	tests := map[string]struct {
+		certificate       *tls.Certificate
+		bearer            string
+		expectedCode      int
+		expectedPrincipal string
+		expectedGroups    []string
+	}{
+		"spiffe id": {
+			certificate:       new(ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "radix-operator", Organization: []string{"radix-system"}}, URIs: []*url.URL{spiffeID}})),
+			expectedCode:      http.StatusOK,
+			expectedPrincipal: spiffeID.String(),
+			expectedGroups:    []string{"radix-system"},
+		},
+		"common name": {
+			certificate:       new(ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "radix-job"}})),
+			expectedCode:      http.StatusOK,
+			expectedPrincipal: "radix-job",
+		},
+		"untrusted certificate": {
+			certificate:  new(newTestCA(t).issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "radix-operator"}})),
+			bearer:       newTestToken(t, jwt.MapClaims{"upn": "user@equinor.com"}),
+			expectedCode: http.StatusUnauthorized,
+		},
+		"expired certificate": {
+			certificate:  new(ca.issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "radix-operator"}, NotBefore: time.Now().Add(-2 * time.Hour), NotAfter: time.Now().Add(-time.Hour)})),
+			expectedCode: http.StatusUnauthorized,
+		},
+		"certificate without principal": {
+			certificate:  new(ca.issue(t, &x509.Certificate{})),
+			expectedCode: http.StatusUnauthorized,
+		},
+		"bearer token without certificate": {
+			bearer:            newTestToken(t, jwt.MapClaims{"upn": "user@equinor.com"}),
+			expectedCode:      http.StatusOK,
+			expectedPrincipal: "user@equinor.com",
+		},
+		"no credentials": {
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			transport := server.Client().Transport.(*http.Transport).Clone()
+			if test.certificate != nil {
+				transport.TLSClientConfig.Certificates = []tls.Certificate{*test.certificate}
+			}
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/whoami", nil)
+			require.NoError(t, err)
+			if len(test.bearer) > 0 {
+				req.Header.Set("Authorization", "Bearer "+test.bearer)
+			}
+
+			resp, err := (&http.Client{Transport: transport}).Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			assert.Equal(t, test.expectedCode, resp.StatusCode)
+			if test.expectedCode == http.StatusOK {
+				assert.Equal(t, test.expectedPrincipal, string(body))
+				assert.Equal(t, test.expectedGroups, resp.Header.Values("X-Groups"))
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package net
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// ClientIPResolver Resolves the client IP of requests forwarded by trusted proxies, e.g. the ingress controller.
+// When the remote address is a trusted proxy, the X-Forwarded-For header is read from the right, skipping trusted proxies,
+// and X-Real-IP is used when X-Forwarded-For is missing, like gin's Context.ClientIP with the same trusted proxies
+type ClientIPResolver struct {
+	trustedProxies []netip.Prefix
+}
+
+// NewClientIPResolver Constructor for ClientIPResolver, trusting the proxies given as IP addresses or CIDRs, e.g. 10.0.0.0/8
+func NewClientIPResolver(trustedProxies ...string) (*ClientIPResolver, error) {
+	resolver := &ClientIPResolver{}
+	for _, proxy := range trustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, err
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		resolver.trustedProxies = append(resolver.trustedProxies, prefix.Masked())
+	}
+	return resolver, nil
+}
+
+// ClientIP The IP of the client sending the request
+func (resolver *ClientIPResolver) ClientIP(r *http.Request) string {
+	remote := remoteAddrIP(r)
+	if !resolver.isTrusted(remote) {
+		return remote
+	}
+
+	if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				return remote
+			}
+			if !resolver.isTrusted(hop) || i == 0 {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); len(realIP) > 0 {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+	return remote
+}
+
+func (resolver *ClientIPResolver) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range resolver.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// withClientIP Returns a copy of the request with the client IP in the context, used by rate limits and idempotency keys
+func withClientIP(r *http.Request, clientIP string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, clientIP))
+}
+
+// remoteIP The client IP resolved by RadixMiddleware, or the IP of the remote address
+func remoteIP(r *http.Request) string {
+	if clientIP, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return clientIP
+	}
+	return remoteAddrIP(r)
+}
+
+func remoteAddrIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
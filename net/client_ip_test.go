@@ -0,0 +1,46 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ClientIPResolver(t *testing.T) {
+	sut, err := NewClientIPResolver("10.0.0.0/8", "192.168.1.1")
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		expected     string
+	}{
+		"untrusted remote address":  {remoteAddr: "203.0.113.9:1234", forwardedFor: "198.51.100.1", expected: "203.0.113.9"},
+		"trusted proxy":             {remoteAddr: "10.0.0.5:1234", forwardedFor: "198.51.100.1", expected: "198.51.100.1"},
+		"chain of trusted proxies":  {remoteAddr: "10.0.0.5:1234", forwardedFor: "198.51.100.1, 192.168.1.1, 10.1.2.3", expected: "198.51.100.1"},
+		"spoofed leftmost hop":      {remoteAddr: "10.0.0.5:1234", forwardedFor: "1.2.3.4, 198.51.100.1", expected: "198.51.100.1"},
+		"invalid hop":               {remoteAddr: "10.0.0.5:1234", forwardedFor: "not-an-ip", expected: "10.0.0.5"},
+		"real ip header":            {remoteAddr: "192.168.1.1:1234", realIP: "198.51.100.2", expected: "198.51.100.2"},
+		"trusted proxy, no headers": {remoteAddr: "10.0.0.5:1234", expected: "10.0.0.5"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			if len(test.forwardedFor) > 0 {
+				req.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			if len(test.realIP) > 0 {
+				req.Header.Set("X-Real-IP", test.realIP)
+			}
+			assert.Equal(t, test.expected, sut.ClientIP(req))
+		})
+	}
+
+	_, err = NewClientIPResolver("not-a-cidr")
+	assert.Error(t, err)
+}
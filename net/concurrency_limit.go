@@ -0,0 +1,95 @@
+package net
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/rs/zerolog"
+)
+
+// ConcurrencyLimiter Limits the number of requests in flight.
+// Excess requests wait in a bounded queue for up to the queue timeout, and are then rejected with 503 Service Unavailable
+type ConcurrencyLimiter struct {
+	inFlight     chan struct{}
+	queue        chan struct{}
+	queueTimeout time.Duration
+}
+
+// NewConcurrencyLimiter Constructor for ConcurrencyLimiter.
+// Panics when maxInFlight is not positive, since every request would be rejected, or when maxQueued is negative
+func NewConcurrencyLimiter(maxInFlight, maxQueued int, queueTimeout time.Duration) *ConcurrencyLimiter {
+	if maxInFlight <= 0 {
+		panic(fmt.Sprintf("concurrency limit: max in flight must be positive, got %d", maxInFlight))
+	}
+	if maxQueued < 0 {
+		panic(fmt.Sprintf("concurrency limit: max queued must not be negative, got %d", maxQueued))
+	}
+	return &ConcurrencyLimiter{
+		inFlight:     make(chan struct{}, maxInFlight),
+		queue:        make(chan struct{}, maxQueued),
+		queueTimeout: queueTimeout,
+	}
+}
+
+// Handler Wraps a http.Handler with the concurrency limit
+func (limiter *ConcurrencyLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release, err := limiter.Enter(w, r)
+		if err != nil {
+			if err := httpUtils.ErrorResponse(w, r, err); err != nil {
+				zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to write concurrency limit error response")
+			}
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Enter Waits for a free slot for the request. The returned release function must be called when the request is handled.
+// When no slot is available within the queue timeout, Retry-After is set and a ServiceUnavailable error is returned
+func (limiter *ConcurrencyLimiter) Enter(w http.ResponseWriter, r *http.Request) (func(), error) {
+	release := func() { <-limiter.inFlight }
+
+	select {
+	case limiter.inFlight <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	select {
+	case limiter.queue <- struct{}{}:
+		defer func() { <-limiter.queue }()
+	default:
+		return nil, limiter.reject(w)
+	}
+
+	timer := time.NewTimer(limiter.queueTimeout)
+	defer timer.Stop()
+	select {
+	case limiter.inFlight <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, limiter.reject(w)
+	case <-r.Context().Done():
+		return nil, r.Context().Err()
+	}
+}
+
+// InFlight Number of requests in flight
+func (limiter *ConcurrencyLimiter) InFlight() int {
+	return len(limiter.inFlight)
+}
+
+// Queued Number of requests waiting for a slot
+func (limiter *ConcurrencyLimiter) Queued() int {
+	return len(limiter.queue)
+}
+
+func (limiter *ConcurrencyLimiter) reject(w http.ResponseWriter) error {
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(limiter.queueTimeout))))
+	return httpUtils.ServiceUnavailableError("Too many requests in progress")
+}
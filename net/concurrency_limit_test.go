@@ -0,0 +1,97 @@
+package net
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ConcurrencyLimiter_QueuesAndSheds(t *testing.T) {
+	sut := NewConcurrencyLimiter(1, 1, 5*time.Second)
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+
+	release, err := sut.Enter(httptest.NewRecorder(), req)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sut.InFlight())
+
+	queued := make(chan error)
+	go func() {
+		release, err := sut.Enter(httptest.NewRecorder(), req)
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+	require.Eventually(t, func() bool { return sut.Queued() == 1 }, time.Second, time.Millisecond)
+
+	w := httptest.NewRecorder()
+	_, err = sut.Enter(w, req)
+	assert.Error(t, err, "Queue is full")
+	assert.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	release()
+	assert.NoError(t, <-queued, "Queued request gets the released slot")
+	assert.Equal(t, 0, sut.InFlight())
+}
+
+func Test_NewConcurrencyLimiter_RejectsInvalidLimits(t *testing.T) {
+	assert.Panics(t, func() { NewConcurrencyLimiter(0, 0, time.Second) })
+	assert.Panics(t, func() { NewConcurrencyLimiter(-1, 0, time.Second) })
+	assert.Panics(t, func() { NewConcurrencyLimiter(1, -1, time.Second) })
+}
+
+func Test_ConcurrencyLimiter_QueueTimeout(t *testing.T) {
+	sut := NewConcurrencyLimiter(1, 1, 10*time.Millisecond)
+	release, err := sut.Enter(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/any", nil))
+	require.NoError(t, err)
+	defer release()
+
+	handler := sut.Handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = sut.Enter(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/any", nil).WithContext(ctx))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func Test_RadixMiddleware_ConcurrencyPools(t *testing.T) {
+	defaultLimiter := NewConcurrencyLimiter(1, 0, 0)
+	streamLimiter := NewConcurrencyLimiter(1, 0, 0)
+	options := []RadixMiddlewareOption{WithConcurrencyLimiter(defaultLimiter), WithConcurrencyPool("logs", streamLimiter)}
+
+	var inFlight []int
+	recordInFlight := func(models.Accounts, http.ResponseWriter, *http.Request) {
+		inFlight = []int{defaultLimiter.InFlight(), streamLimiter.InFlight()}
+	}
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/any", nil)
+		req.Header.Set("Authorization", "Bearer any-token")
+		return req
+	}
+
+	NewRadixMiddlewareForRoute(models.Route{Path: "/api", HandlerFunc: recordInFlight}, nil, options...).Handle(httptest.NewRecorder(), newRequest())
+	assert.Equal(t, []int{1, 0}, inFlight)
+
+	NewRadixMiddlewareForRoute(models.Route{Path: "/events", Streaming: true, HandlerFunc: recordInFlight}, nil, options...).Handle(httptest.NewRecorder(), newRequest())
+	assert.Equal(t, []int{0, 0}, inFlight, "Streaming routes are excluded from the default pool")
+
+	NewRadixMiddlewareForRoute(models.Route{Path: "/logs", Streaming: true, ConcurrencyPool: "logs", HandlerFunc: recordInFlight}, nil, options...).Handle(httptest.NewRecorder(), newRequest())
+	assert.Equal(t, []int{0, 1}, inFlight)
+
+	release, err := defaultLimiter.Enter(httptest.NewRecorder(), newRequest())
+	require.NoError(t, err)
+	defer release()
+	w := httptest.NewRecorder()
+	NewRadixMiddlewareForRoute(models.Route{Path: "/api", HandlerFunc: recordInFlight}, nil, options...).Handle(w, newRequest())
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
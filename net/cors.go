@@ -0,0 +1,173 @@
+package net
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// CORSPolicy Cross-Origin Resource Sharing policy
+type CORSPolicy struct {
+	// AllowedOrigins Exact origins, or patterns where * matches any sequence of characters, e.g. https://*.radix.equinor.com.
+	// A single * allows any origin
+	AllowedOrigins []string
+	// AllowedMethods Methods allowed in preflight requests. Defaults to GET, HEAD and POST
+	AllowedMethods []string
+	// AllowedHeaders Headers allowed in preflight requests. A single * allows any header
+	AllowedHeaders []string
+	// ExposedHeaders Response headers the browser exposes to the client
+	ExposedHeaders []string
+	// AllowCredentials Allows cookies and authorization headers to be sent with cross-origin requests.
+	// Credentials are never allowed when AllowedOrigins is a single *, since any site could then make credentialed requests
+	AllowCredentials bool
+	// MaxAge How long the result of a preflight request can be cached
+	MaxAge time.Duration
+}
+
+// Handler Wraps a http.Handler with the CORS policy
+func (policy *CORSPolicy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if policy.Apply(w, r) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Apply Sets the CORS headers for the request. Preflight requests are answered with 204 No Content,
+// and true is returned to signal that the request is handled
+func (policy *CORSPolicy) Apply(w http.ResponseWriter, r *http.Request) bool {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+
+	preflight := isPreflightRequest(r)
+	if preflight {
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	}
+
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 || !policy.isOriginAllowed(origin) {
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return preflight
+	}
+
+	if policy.allowsAnyOrigin() {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+		if policy.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+
+	if !preflight {
+		if len(policy.ExposedHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+		}
+		return false
+	}
+
+	method := r.Header.Get("Access-Control-Request-Method")
+	requestedHeaders := parseHeaderList(r.Header.Get("Access-Control-Request-Headers"))
+	if policy.isMethodAllowed(method) && policy.areHeadersAllowed(requestedHeaders) {
+		header.Set("Access-Control-Allow-Methods", strings.Join(policy.allowedMethods(), ", "))
+		if len(requestedHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+		}
+		if policy.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func (policy *CORSPolicy) allowsAnyOrigin() bool {
+	for _, allowedOrigin := range policy.AllowedOrigins {
+		if allowedOrigin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *CORSPolicy) isOriginAllowed(origin string) bool {
+	for _, allowedOrigin := range policy.AllowedOrigins {
+		if matchWildcard(strings.ToLower(allowedOrigin), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *CORSPolicy) allowedMethods() []string {
+	if len(policy.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return policy.AllowedMethods
+}
+
+func (policy *CORSPolicy) isMethodAllowed(method string) bool {
+	for _, allowedMethod := range policy.allowedMethods() {
+		if strings.EqualFold(allowedMethod, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *CORSPolicy) areHeadersAllowed(headers []string) bool {
+	for _, header := range headers {
+		allowed := false
+		for _, allowedHeader := range policy.AllowedHeaders {
+			if allowedHeader == "*" || strings.EqualFold(allowedHeader, header) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+func isPreflightRequest(r *http.Request) bool {
+	return r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0
+}
+
+func parseHeaderList(value string) []string {
+	var headers []string
+	for _, header := range strings.Split(value, ",") {
+		if header = strings.TrimSpace(header); len(header) > 0 {
+			headers = append(headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	return headers
+}
+
+// matchWildcard Matches value against pattern, where * in pattern matches any sequence of characters
+func matchWildcard(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(value, part)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(part):]
+	}
+	return strings.HasSuffix(value, parts[len(parts)-1])
+}
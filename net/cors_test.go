@@ -0,0 +1,133 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CORSPolicy_ActualRequest(t *testing.T) {
+	policy := &CORSPolicy{
+		AllowedOrigins:   []string{"https://console.radix.equinor.com", "https://*.playground.radix.equinor.com"},
+		ExposedHeaders:   []string{"X-Total-Count"},
+		AllowCredentials: true,
+	}
+
+	tests := map[string]struct {
+		origin         string
+		expectedOrigin string
+	}{
+		"exact origin":      {origin: "https://console.radix.equinor.com", expectedOrigin: "https://console.radix.equinor.com"},
+		"pattern origin":    {origin: "https://console.playground.radix.equinor.com", expectedOrigin: "https://console.playground.radix.equinor.com"},
+		"disallowed origin": {origin: "https://evil.com"},
+		"no origin":         {},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/any", nil)
+			if len(test.origin) > 0 {
+				req.Header.Set("Origin", test.origin)
+			}
+			w := httptest.NewRecorder()
+
+			handled := policy.Apply(w, req)
+
+			assert.False(t, handled)
+			assert.Equal(t, test.expectedOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Contains(t, w.Header().Values("Vary"), "Origin")
+			if len(test.expectedOrigin) > 0 {
+				assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+				assert.Equal(t, "X-Total-Count", w.Header().Get("Access-Control-Expose-Headers"))
+			}
+		})
+	}
+}
+
+func Test_CORSPolicy_AnyOriginWithoutCredentials(t *testing.T) {
+	policy := &CORSPolicy{AllowedOrigins: []string{"*"}}
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req.Header.Set("Origin", "https://any.com")
+	w := httptest.NewRecorder()
+
+	policy.Apply(w, req)
+
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func Test_CORSPolicy_AnyOriginNeverAllowsCredentials(t *testing.T) {
+	policy := &CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+
+	for _, method := range []string{http.MethodGet, http.MethodOptions} {
+		req := httptest.NewRequest(method, "/any", nil)
+		req.Header.Set("Origin", "https://evil.com")
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+
+		policy.Apply(w, req)
+
+		assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"), method)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"), method)
+	}
+}
+
+func Test_CORSPolicy_Preflight(t *testing.T) {
+	policy := &CORSPolicy{
+		AllowedOrigins: []string{"https://console.radix.equinor.com"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPut},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	req := httptest.NewRequest(http.MethodOptions, "/any", nil)
+	req.Header.Set("Origin", "https://console.radix.equinor.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+	req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+	w := httptest.NewRecorder()
+	assert.True(t, policy.Apply(w, req))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://console.radix.equinor.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, Content-Type", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	w = httptest.NewRecorder()
+	assert.True(t, policy.Apply(w, req))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func Test_RadixMiddleware_CORSPolicy(t *testing.T) {
+	called := false
+	route := models.Route{Path: "/any", Method: http.MethodGet, HandlerFunc: func(models.Accounts, http.ResponseWriter, *http.Request) { called = true }}
+	policy := &CORSPolicy{AllowedOrigins: []string{"https://console.radix.equinor.com"}}
+
+	sut := NewRadixMiddlewareForRoute(route, nil)
+	w := httptest.NewRecorder()
+	sut.Handle(w, httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"), "Legacy behaviour without policy")
+
+	sut = NewRadixMiddlewareForRoute(route, nil, WithCORSPolicy(policy))
+	req := httptest.NewRequest(http.MethodOptions, "/any", nil)
+	req.Header.Set("Origin", "https://console.radix.equinor.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w = httptest.NewRecorder()
+	sut.Handle(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://console.radix.equinor.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.False(t, called, "Preflight must not require authentication or reach the handler")
+}
+
+func Test_matchWildcard(t *testing.T) {
+	assert.True(t, matchWildcard("https://*.radix.equinor.com", "https://console.radix.equinor.com"))
+	assert.True(t, matchWildcard("*", "https://any.com"))
+	assert.True(t, matchWildcard("http://localhost:*", "http://localhost:3000"))
+	assert.False(t, matchWildcard("https://*.radix.equinor.com", "https://radix.equinor.com.evil.com"))
+	assert.False(t, matchWildcard("https://radix.equinor.com", "https://radix.equinor.com.evil.com"))
+}
@@ -0,0 +1,47 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	httpUtils "github.com/equinor/radix-common/net/http"
+)
+
+// writeDeprecationHeaders Announces the deprecation of the route with the Deprecation header (RFC 9745),
+// the Sunset header (RFC 8594), a successor-version link to the replacement and a warning added to the request context
+func (handler *RadixMiddleware) writeDeprecationHeaders(ctx context.Context, header http.Header) {
+	deprecation := handler.deprecation
+
+	if deprecation.Date.IsZero() {
+		header.Set("Deprecation", "true")
+	} else {
+		header.Set("Deprecation", "@"+strconv.FormatInt(deprecation.Date.Unix(), 10))
+	}
+	if !deprecation.Sunset.IsZero() {
+		header.Set("Sunset", deprecation.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if len(deprecation.Replacement) > 0 {
+		header.Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, deprecation.Replacement))
+	}
+
+	message := deprecation.Message
+	if len(message) == 0 {
+		message = handler.deprecationMessage()
+	}
+	httpUtils.AddWarning(ctx, message)
+}
+
+func (handler *RadixMiddleware) deprecationMessage() string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "%s %s is deprecated", handler.Method, handler.Path)
+	if !handler.deprecation.Sunset.IsZero() {
+		fmt.Fprintf(&message, " and will be removed after %s", handler.deprecation.Sunset.UTC().Format("2006-01-02"))
+	}
+	if len(handler.deprecation.Replacement) > 0 {
+		fmt.Fprintf(&message, ", use %s instead", handler.deprecation.Replacement)
+	}
+	return message.String()
+}
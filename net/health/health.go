@@ -0,0 +1,315 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/equinor/radix-common/utils"
+	"github.com/rs/zerolog"
+)
+
+// DefaultTimeout Timeout of checks without their own timeout
+const DefaultTimeout = 5 * time.Second
+
+// Status Health status of a check or of the service
+type Status string
+
+const (
+	// StatusOK All checks pass
+	StatusOK Status = "ok"
+	// StatusDegraded Only non-critical checks fail. The service is still ready
+	StatusDegraded Status = "degraded"
+	// StatusFailing A critical check fails. The service is not ready
+	StatusFailing Status = "failing"
+	// StatusStarting Initialization is not completed. The service is not ready
+	StatusStarting Status = "starting"
+	// StatusStopping The service is shutting down, and is not ready for new requests
+	StatusStopping Status = "stopping"
+)
+
+// ErrTimeout The check did not complete within its timeout
+var ErrTimeout = errors.New("health check timed out")
+
+// CheckFunc Checks a dependency, returning an error when it is unhealthy.
+// The context is cancelled when the timeout of the check expires
+type CheckFunc func(ctx context.Context) error
+
+// Check Named health check
+type Check struct {
+	Name  string
+	Check CheckFunc
+	// Timeout Time allowed for the check. Defaults to DefaultTimeout
+	Timeout time.Duration
+	// Critical The service is not ready when a critical check fails
+	Critical bool
+	// CacheInterval Time the result of the check is reused, to protect the dependency from frequent probes
+	CacheInterval time.Duration
+}
+
+// CheckResult Result of a check
+type CheckResult struct {
+	Name      string        `json:"name"`
+	Status    Status        `json:"status"`
+	Critical  bool          `json:"critical"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// Report Status of the service and the results of all checks
+type Report struct {
+	Status Status        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Ready Reports whether the service is ready to receive requests
+func (report Report) Ready() bool {
+	return report.Status == StatusOK || report.Status == StatusDegraded
+}
+
+type registeredCheck struct {
+	Check
+	// running Held while the check runs, so a dependency is probed by one caller at a time
+	running sync.Mutex
+	mu      sync.Mutex
+	result  *CheckResult
+}
+
+func (check *registeredCheck) lastResult() *CheckResult {
+	check.mu.Lock()
+	defer check.mu.Unlock()
+	return check.result
+}
+
+func (check *registeredCheck) setResult(result CheckResult) {
+	check.mu.Lock()
+	defer check.mu.Unlock()
+	check.result = &result
+}
+
+// Registry Named health checks, served as liveness, readiness, startup and detailed report endpoints
+type Registry struct {
+	clock    utils.Clock
+	started  atomic.Bool
+	stopping atomic.Bool
+
+	mu     sync.RWMutex
+	checks map[string]*registeredCheck
+}
+
+// Option Option for the Registry
+type Option func(*Registry)
+
+// WithClock Clock used for check durations and cached results
+func WithClock(clock utils.Clock) Option {
+	return func(registry *Registry) {
+		registry.clock = clock
+	}
+}
+
+// NewRegistry Constructor for Registry
+func NewRegistry(options ...Option) *Registry {
+	registry := &Registry{
+		clock:  utils.RealClock{},
+		checks: map[string]*registeredCheck{},
+	}
+	for _, option := range options {
+		option(registry)
+	}
+	return registry
+}
+
+// Register Adds the checks. Panics if a check with the same name is already registered
+func (registry *Registry) Register(checks ...Check) *Registry {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	for _, check := range checks {
+		if _, ok := registry.checks[check.Name]; ok {
+			panic(fmt.Sprintf("health: check %q is already registered", check.Name))
+		}
+		if check.Timeout <= 0 {
+			check.Timeout = DefaultTimeout
+		}
+		registry.checks[check.Name] = &registeredCheck{Check: check}
+	}
+	return registry
+}
+
+// MarkStarted Marks the initialization as completed. The startup probe succeeds, and readiness is decided by the checks
+func (registry *Registry) MarkStarted() {
+	registry.started.Store(true)
+}
+
+// Started Reports whether the initialization is completed
+func (registry *Registry) Started() bool {
+	return registry.started.Load()
+}
+
+// MarkStopping Marks the service as shutting down. Readiness fails, so load balancers stop sending new requests
+func (registry *Registry) MarkStopping() {
+	registry.stopping.Store(true)
+}
+
+// Stopping Reports whether the service is shutting down
+func (registry *Registry) Stopping() bool {
+	return registry.stopping.Load()
+}
+
+// Run Runs the checks concurrently, reusing cached results, and reports the status of the service
+func (registry *Registry) Run(ctx context.Context) Report {
+	registry.mu.RLock()
+	checks := make([]*registeredCheck, 0, len(registry.checks))
+	for _, check := range registry.checks {
+		checks = append(checks, check)
+	}
+	registry.mu.RUnlock()
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = registry.runCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		switch {
+		case result.Status == StatusOK:
+		case result.Critical:
+			report.Status = StatusFailing
+		case report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	switch {
+	case registry.Stopping():
+		report.Status = StatusStopping
+	case !registry.Started():
+		report.Status = StatusStarting
+	}
+	return report
+}
+
+func (registry *Registry) runCheck(ctx context.Context, check *registeredCheck) CheckResult {
+	if !check.running.TryLock() {
+		// Another probe is running the check. Its last result is reported, instead of queueing behind a slow check
+		if result := check.lastResult(); result != nil {
+			return *result
+		}
+		check.running.Lock()
+	}
+	defer check.running.Unlock()
+
+	now := registry.clock.Now()
+	if result := check.lastResult(); result != nil && now.Sub(result.CheckedAt) < check.CacheInterval {
+		return *result
+	}
+
+	// The check is not cancelled with the caller, so the timeout is only reported when the check overruns
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), check.Timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Check.Check(checkCtx)
+	}()
+
+	var err error
+	callerCancelled := false
+	select {
+	case err = <-done:
+	case <-checkCtx.Done():
+		err = ErrTimeout
+	case <-ctx.Done():
+		err, callerCancelled = ctx.Err(), true
+	}
+
+	result := CheckResult{Name: check.Name, Status: StatusOK, Critical: check.Critical, CheckedAt: now, Duration: registry.clock.Now().Sub(now)}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+	if !callerCancelled {
+		// The result of an abandoned check says nothing about the dependency, so it is not cached
+		check.setResult(result)
+	}
+	return result
+}
+
+// LivenessHandler Answers 200 OK while the process is able to serve requests. Checks are not run,
+// so a failing dependency does not cause the service to be restarted
+func (registry *Registry) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// StartupHandler Answers 200 OK once MarkStarted is called, otherwise 503 Service Unavailable
+func (registry *Registry) StartupHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !registry.Started() {
+			writeJSON(w, r, http.StatusServiceUnavailable, Report{Status: StatusStarting})
+			return
+		}
+		writeJSON(w, r, http.StatusOK, Report{Status: StatusOK})
+	})
+}
+
+// ReadinessHandler Answers 200 OK when the service is started, not stopping and all critical checks pass, otherwise 503 Service Unavailable
+func (registry *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := registry.Run(r.Context())
+		writeJSON(w, r, statusCode(report), Report{Status: report.Status})
+	})
+}
+
+// ReportHandler Answers with the detailed report of all checks, with the status code of the readiness probe
+func (registry *Registry) ReportHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := registry.Run(r.Context())
+		writeJSON(w, r, statusCode(report), report)
+	})
+}
+
+// Handler Serves /livez, /readyz, /startupz and the detailed report on /healthz
+func (registry *Registry) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /livez", registry.LivenessHandler())
+	mux.Handle("GET /readyz", registry.ReadinessHandler())
+	mux.Handle("GET /startupz", registry.StartupHandler())
+	mux.Handle("GET /healthz", registry.ReportHandler())
+	return mux
+}
+
+func statusCode(report Report) int {
+	if report.Ready() {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, report Report) {
+	body, err := json.Marshal(report)
+	if err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to marshal health report")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if _, err = w.Write(body); err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to write health report")
+	}
+}
@@ -0,0 +1,188 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serve(t *testing.T, handler http.Handler, path string) (int, Report) {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	var report Report
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return w.Code, report
+}
+
+func Test_Registry_Probes(t *testing.T) {
+	var databaseAvailable atomic.Bool
+	registry := NewRegistry().Register(
+		Check{Name: "database", Critical: true, Check: func(context.Context) error {
+			if !databaseAvailable.Load() {
+				return errors.New("connection refused")
+			}
+			return nil
+		}},
+		Check{Name: "cache", Check: func(context.Context) error { return errors.New("any error") }},
+	)
+	handler := registry.Handler()
+
+	code, report := serve(t, handler, "/startupz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusStarting, report.Status)
+	code, _ = serve(t, handler, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "Not ready before initialization completes")
+	code, _ = serve(t, handler, "/livez")
+	assert.Equal(t, http.StatusOK, code, "Live while starting")
+
+	registry.MarkStarted()
+	code, _ = serve(t, handler, "/startupz")
+	assert.Equal(t, http.StatusOK, code)
+	code, report = serve(t, handler, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusFailing, report.Status)
+	assert.Empty(t, report.Checks, "Readiness does not include check details")
+	code, _ = serve(t, handler, "/livez")
+	assert.Equal(t, http.StatusOK, code, "Live when dependencies fail")
+
+	databaseAvailable.Store(true)
+	code, report = serve(t, handler, "/healthz")
+	assert.Equal(t, http.StatusOK, code, "Ready when only non-critical checks fail")
+	assert.Equal(t, StatusDegraded, report.Status)
+	require.Len(t, report.Checks, 2)
+	assert.Equal(t, CheckResult{Name: "cache", Status: StatusFailing, Error: "any error"}, withoutTimes(report.Checks[0]))
+	assert.Equal(t, CheckResult{Name: "database", Status: StatusOK, Critical: true}, withoutTimes(report.Checks[1]))
+}
+
+func withoutTimes(result CheckResult) CheckResult {
+	result.Duration, result.CheckedAt = 0, time.Time{}
+	return result
+}
+
+func Test_Registry_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	registry := NewRegistry().Register(Check{Name: "slow", Critical: true, Timeout: 10 * time.Millisecond, Check: func(context.Context) error {
+		<-release
+		return nil
+	}})
+	registry.MarkStarted()
+
+	report := registry.Run(context.Background())
+	assert.Equal(t, StatusFailing, report.Status, "Checks that ignore the context are abandoned on timeout")
+	assert.Equal(t, ErrTimeout.Error(), report.Checks[0].Error)
+}
+
+func Test_Registry_CacheInterval(t *testing.T) {
+	clock := utils.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	var calls atomic.Int32
+	registry := NewRegistry(WithClock(clock)).Register(Check{Name: "any", CacheInterval: time.Minute, Check: func(context.Context) error {
+		calls.Add(1)
+		return nil
+	}})
+
+	registry.Run(context.Background())
+	clock.Advance(30 * time.Second)
+	registry.Run(context.Background())
+	assert.Equal(t, int32(1), calls.Load(), "The cached result is used within the interval")
+
+	clock.Advance(30 * time.Second)
+	registry.Run(context.Background())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func Test_Registry_CallerCancelledIsNotCached(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	var calls atomic.Int32
+	registry := NewRegistry().Register(Check{Name: "any", Critical: true, Timeout: time.Minute, CacheInterval: time.Minute, Check: func(ctx context.Context) error {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return ctx.Err()
+	}})
+	registry.MarkStarted()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	report := registry.Run(ctx)
+	assert.Equal(t, StatusFailing, report.Status, "The probe caller gave up")
+	assert.NotEqual(t, ErrTimeout.Error(), report.Checks[0].Error)
+
+	report = registry.Run(context.Background())
+	assert.Equal(t, StatusOK, report.Status, "The result of the cancelled run is not cached")
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func Test_Registry_ConcurrentProbesReuseLastResult(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls atomic.Int32
+	registry := NewRegistry().Register(Check{Name: "any", Critical: true, Timeout: time.Minute, Check: func(context.Context) error {
+		if calls.Add(1) == 2 {
+			close(started)
+			<-release
+			return errors.New("any error")
+		}
+		return nil
+	}})
+	registry.MarkStarted()
+	require.Equal(t, StatusOK, registry.Run(context.Background()).Status)
+
+	slow := make(chan Report)
+	go func() { slow <- registry.Run(context.Background()) }()
+	<-started
+	report := registry.Run(context.Background())
+	assert.Equal(t, StatusOK, report.Status, "The last result is reported while the check runs")
+	assert.Equal(t, int32(2), calls.Load(), "The check is not run again while it is running")
+
+	close(release)
+	assert.Equal(t, StatusFailing, (<-slow).Status)
+}
+
+func Test_Registry_DuplicateName(t *testing.T) {
+	registry := NewRegistry().Register(Check{Name: "any", Check: func(context.Context) error { return nil }})
+	assert.Panics(t, func() {
+		registry.Register(Check{Name: "any", Check: func(context.Context) error { return nil }})
+	})
+}
+
+func Test_HTTPCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ok" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	assert.NoError(t, HTTPCheck(server.Client(), server.URL+"/ok")(context.Background()))
+	assert.ErrorContains(t, HTTPCheck(server.Client(), server.URL+"/failing")(context.Background()), "unexpected status 502")
+}
+
+func Test_Registry_Stopping(t *testing.T) {
+	registry := NewRegistry()
+	registry.MarkStarted()
+	code, _ := serve(t, registry.ReadinessHandler(), "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+
+	registry.MarkStopping()
+	code, report := serve(t, registry.ReadinessHandler(), "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusStopping, report.Status)
+	code, _ = serve(t, registry.LivenessHandler(), "/livez")
+	assert.Equal(t, http.StatusOK, code, "Live while stopping")
+}
@@ -2,7 +2,9 @@ package http
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/equinor/radix-common/models"
@@ -35,6 +37,43 @@ func GetImpersonationFromHeader(r *http.Request) (models.Impersonation, error) {
 }
 
 // GetTokenFromQuery Gets token from query of the request
+//
+// Deprecated: Tokens in URLs end up in browser history and access logs. Use signed URLs, see net.URLSigner
 func GetTokenFromQuery(request *http.Request) string {
 	return request.URL.Query().Get("token")
 }
+
+// PathParamType Types supported by GetPathParam
+type PathParamType interface {
+	string | int | int64 | uint64 | bool | float64
+}
+
+// GetPathParam Gets the named path parameter of the request, converted to T.
+// A missing or invalid path parameter is returned as a ValidationError
+func GetPathParam[T PathParamType](r *http.Request, name string) (T, error) {
+	var value T
+	raw := r.PathValue(name)
+	if len(raw) == 0 {
+		return value, ValidationError("path parameter", fmt.Sprintf("missing path parameter %s", name))
+	}
+
+	var err error
+	switch v := any(&value).(type) {
+	case *string:
+		*v = raw
+	case *int:
+		*v, err = strconv.Atoi(raw)
+	case *int64:
+		*v, err = strconv.ParseInt(raw, 10, 64)
+	case *uint64:
+		*v, err = strconv.ParseUint(raw, 10, 64)
+	case *bool:
+		*v, err = strconv.ParseBool(raw)
+	case *float64:
+		*v, err = strconv.ParseFloat(raw, 64)
+	}
+	if err != nil {
+		return value, ValidationError("path parameter", fmt.Sprintf("invalid value %q for path parameter %s", raw, name))
+	}
+	return value, nil
+}
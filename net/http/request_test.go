@@ -30,3 +30,28 @@ func Test_GetImpersonationFromHeader(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, expected, actual)
 }
+
+func Test_GetPathParam(t *testing.T) {
+	req := &http.Request{}
+	req.SetPathValue("appName", "any-app")
+	req.SetPathValue("jobIndex", "3")
+	req.SetPathValue("follow", "true")
+
+	appName, err := GetPathParam[string](req, "appName")
+	require.NoError(t, err)
+	assert.Equal(t, "any-app", appName)
+
+	jobIndex, err := GetPathParam[int](req, "jobIndex")
+	require.NoError(t, err)
+	assert.Equal(t, 3, jobIndex)
+
+	follow, err := GetPathParam[bool](req, "follow")
+	require.NoError(t, err)
+	assert.True(t, follow)
+
+	_, err = GetPathParam[int](req, "appName")
+	assert.Error(t, err)
+
+	_, err = GetPathParam[string](req, "missing")
+	assert.Error(t, err)
+}
@@ -54,6 +54,18 @@ const (
 	User = "user"
 	// Forbidden The operation is not allowed for the current authenticated user
 	Forbidden = "forbidden"
+	// Unauthorized The request is missing valid authentication credentials
+	Unauthorized = "unauthorized"
+	// TooManyRequests The caller has sent too many requests, and should retry later
+	TooManyRequests = "toomanyrequests"
+	// Unavailable The service is temporarily unable to handle the request, and the caller should retry later
+	Unavailable = "unavailable"
+	// Timeout The operation did not complete within the time allowed for the request
+	Timeout = "timeout"
+	// Conflict The operation conflicts with the current state, e.g. an identical request in progress
+	Conflict = "conflict"
+	// Unprocessable The request is well-formed, but cannot be processed, e.g. a reused idempotency key with a different payload
+	Unprocessable = "unprocessable"
 )
 
 // MarshalJSON Writes error as json
@@ -127,6 +139,54 @@ func ForbiddenError(message string) error {
 	}
 }
 
+// UnauthorizedError unauthorized error
+func UnauthorizedError(message string) error {
+	return &Error{
+		Type:    Unauthorized,
+		Message: message,
+	}
+}
+
+// TooManyRequestsError too many requests error
+func TooManyRequestsError(message string) error {
+	return &Error{
+		Type:    TooManyRequests,
+		Message: message,
+	}
+}
+
+// ServiceUnavailableError service unavailable error
+func ServiceUnavailableError(message string) error {
+	return &Error{
+		Type:    Unavailable,
+		Message: message,
+	}
+}
+
+// GatewayTimeoutError timeout error
+func GatewayTimeoutError(message string) error {
+	return &Error{
+		Type:    Timeout,
+		Message: message,
+	}
+}
+
+// ConflictError conflict error
+func ConflictError(message string) error {
+	return &Error{
+		Type:    Conflict,
+		Message: message,
+	}
+}
+
+// UnprocessableEntityError unprocessable entity error
+func UnprocessableEntityError(message string) error {
+	return &Error{
+		Type:    Unprocessable,
+		Message: message,
+	}
+}
+
 // NotFoundError No found error
 func NotFoundError(message string) error {
 	return &Error{
@@ -155,6 +215,7 @@ func CoverAllError(err error, requesterType Type) *Error {
 
 // StringResponse Used for textual response data. I.e. log data
 func StringResponse(w http.ResponseWriter, r *http.Request, result string) error {
+	WriteWarnings(w, r)
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	_, err := w.Write([]byte(result))
@@ -163,6 +224,7 @@ func StringResponse(w http.ResponseWriter, r *http.Request, result string) error
 
 // ByteArrayResponse Used for response data. I.e. image
 func ByteArrayResponse(w http.ResponseWriter, r *http.Request, contentType string, result []byte) error {
+	WriteWarnings(w, r)
 	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(http.StatusOK)
 	_, err := w.Write(result)
@@ -176,6 +238,7 @@ func JSONResponse(w http.ResponseWriter, r *http.Request, result interface{}) er
 		return ErrorResponse(w, r, err)
 	}
 
+	WriteWarnings(w, r)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write(body)
@@ -198,6 +261,11 @@ func ReaderResponse(w http.ResponseWriter, reader io.Reader, contentType string)
 	return err
 }
 
+// ErrorTypeRecorder Implemented by response writers that record the Type of the error written by ErrorResponse, e.g. for metrics
+type ErrorTypeRecorder interface {
+	RecordErrorType(errorType Type)
+}
+
 // ErrorResponse Marshals error for user requester
 func ErrorResponse(w http.ResponseWriter, r *http.Request, apiError error) error {
 	return errorResponseFor(User, w, r, apiError)
@@ -210,7 +278,6 @@ func ErrorResponseForServer(w http.ResponseWriter, r *http.Request, apiError err
 
 func errorResponseFor(requesterType Type, w http.ResponseWriter, r *http.Request, apiError error) error {
 	var outErr *Error
-	var code int
 	var ok bool
 
 	// Skip error response if the context is cancelled.
@@ -229,6 +296,10 @@ func errorResponseFor(requesterType Type, w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	if recorder, ok := w.(ErrorTypeRecorder); ok {
+		recorder.RecordErrorType(outErr.Type)
+	}
+
 	switch e := apiError.(type) {
 	case *url.Error:
 		// Reflect any underlying network error
@@ -237,23 +308,39 @@ func errorResponseFor(requesterType Type, w http.ResponseWriter, r *http.Request
 		return writeErrorWithCode(w, r, int(e.ErrStatus.Code), outErr)
 
 	default:
-		switch outErr.Type {
-		case Missing:
-			code = http.StatusNotFound
-		case User:
-			code = http.StatusBadRequest
-		case Server:
-			code = http.StatusInternalServerError
-		case Forbidden:
-			code = http.StatusForbidden
-		default:
-			code = http.StatusInternalServerError
-		}
-		return writeErrorWithCode(w, r, code, outErr)
+		return writeErrorWithCode(w, r, StatusCode(outErr.Type), outErr)
+	}
+}
+
+// StatusCode HTTP status code of errors of the Type
+func StatusCode(errorType Type) int {
+	switch errorType {
+	case Missing:
+		return http.StatusNotFound
+	case User:
+		return http.StatusBadRequest
+	case Forbidden:
+		return http.StatusForbidden
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case TooManyRequests:
+		return http.StatusTooManyRequests
+	case Unavailable:
+		return http.StatusServiceUnavailable
+	case Timeout:
+		return http.StatusGatewayTimeout
+	case Conflict:
+		return http.StatusConflict
+	case Unprocessable:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
 	}
 }
 
 func writeErrorWithCode(w http.ResponseWriter, r *http.Request, code int, apiError *Error) error {
+	WriteWarnings(w, r)
+
 	// An Accept header with "application/json" is sent by clients
 	// understanding how to decode JSON errors. Older clients don't
 	// send an Accept header, so we just give them the error text.
@@ -0,0 +1,70 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+const warningHeader = "Warning"
+
+type warningsKey struct{}
+
+// warnings Warnings added by handlers, not yet written to the response
+type warnings struct {
+	mu      sync.Mutex
+	pending []string
+	written []string
+}
+
+// ContextWithWarnings Returns a copy of the context collecting warnings added with AddWarning.
+// The context is unchanged when it already collects warnings
+func ContextWithWarnings(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(warningsKey{}).(*warnings); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, warningsKey{}, &warnings{})
+}
+
+// AddWarning Adds a warning for the response of the request, written as a Warning header by the response helpers
+// in this package, like Kubernetes API warnings. RadixMiddleware writes the warnings of other responses, e.g. ReaderResponse,
+// before the status code. Duplicate warnings are written once.
+// Warnings are dropped when the context does not collect warnings, see ContextWithWarnings
+func AddWarning(ctx context.Context, text string) {
+	collected, ok := ctx.Value(warningsKey{}).(*warnings)
+	if !ok {
+		return
+	}
+	collected.mu.Lock()
+	defer collected.mu.Unlock()
+	if !slices.Contains(collected.pending, text) && !slices.Contains(collected.written, text) {
+		collected.pending = append(collected.pending, text)
+	}
+}
+
+// WriteWarnings Adds the warnings collected in the request context to the response headers.
+// Must be called before the status code is written. Called by the response helpers in this package
+func WriteWarnings(w http.ResponseWriter, r *http.Request) {
+	if r == nil {
+		return
+	}
+	collected, ok := r.Context().Value(warningsKey{}).(*warnings)
+	if !ok {
+		return
+	}
+	collected.mu.Lock()
+	defer collected.mu.Unlock()
+	for _, text := range collected.pending {
+		AddWarningHeader(w.Header(), text)
+	}
+	collected.written = append(collected.written, collected.pending...)
+	collected.pending = nil
+}
+
+// AddWarningHeader Adds a Warning header with the text, with warn code 299 (miscellaneous persistent warning)
+// and no warn agent, as written by the Kubernetes API
+func AddWarningHeader(header http.Header, text string) {
+	header.Add(warningHeader, "299 - "+strconv.Quote(text))
+}
@@ -0,0 +1,46 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Warnings_WrittenByResponseHelpers(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req = req.WithContext(ContextWithWarnings(req.Context()))
+	AddWarning(req.Context(), "field spec.foo is deprecated")
+	AddWarning(req.Context(), `use "bar" instead`)
+	AddWarning(req.Context(), "field spec.foo is deprecated")
+
+	w := httptest.NewRecorder()
+	require.NoError(t, JSONResponse(w, req, map[string]string{"name": "app"}))
+	assert.Equal(t, []string{`299 - "field spec.foo is deprecated"`, `299 - "use \"bar\" instead"`}, w.Header().Values("Warning"))
+
+	w = httptest.NewRecorder()
+	require.NoError(t, StringResponse(w, req, "ok"))
+	assert.Empty(t, w.Header().Values("Warning"), "Warnings are written once")
+
+	AddWarning(req.Context(), "field spec.foo is deprecated")
+	AddWarning(req.Context(), "the request failed")
+	w = httptest.NewRecorder()
+	require.NoError(t, ErrorResponse(w, req, errors.New("any error")))
+	assert.Equal(t, []string{`299 - "the request failed"`}, w.Header().Values("Warning"))
+}
+
+func Test_AddWarning_WithoutCollector(t *testing.T) {
+	AddWarning(context.Background(), "dropped")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	require.NoError(t, StringResponse(w, req, "ok"))
+	assert.Empty(t, w.Header().Values("Warning"))
+
+	ctx := ContextWithWarnings(context.Background())
+	assert.Equal(t, ctx, ContextWithWarnings(ctx))
+}
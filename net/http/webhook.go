@@ -0,0 +1,217 @@
+package http
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/equinor/radix-common/utils"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultWebhookMaxBodySize = 25 << 20
+	defaultWebhookMaxAge      = 5 * time.Minute
+)
+
+// WebhookScheme Describes how a webhook provider signs deliveries with HMAC-SHA256
+type WebhookScheme struct {
+	// SignatureHeader Header holding the signature, e.g. X-Hub-Signature-256
+	SignatureHeader string
+	// SignaturePrefix Prefix of the signature in the header, e.g. sha256=
+	SignaturePrefix string
+	// Base64 The signature is base64 encoded. Defaults to hex
+	Base64 bool
+	// TimestampHeader Optional header with the delivery time in Unix seconds. Stale deliveries are rejected when set.
+	// The timestamp must be signed, so SignedPayload is required with a timestamp header
+	TimestampHeader string
+	// SignedPayload Builds the signed payload from the request and body, including the timestamp for schemes with a timestamp header.
+	// Defaults to the body
+	SignedPayload func(r *http.Request, body []byte) []byte
+}
+
+// GitHubWebhookScheme Signature of GitHub webhook deliveries in the X-Hub-Signature-256 header
+var GitHubWebhookScheme = WebhookScheme{
+	SignatureHeader: "X-Hub-Signature-256",
+	SignaturePrefix: "sha256=",
+}
+
+// SlackWebhookScheme Signature of Slack requests, signing the timestamp and body
+var SlackWebhookScheme = WebhookScheme{
+	SignatureHeader: "X-Slack-Signature",
+	SignaturePrefix: "v0=",
+	TimestampHeader: "X-Slack-Request-Timestamp",
+	SignedPayload: func(r *http.Request, body []byte) []byte {
+		return append([]byte("v0:"+r.Header.Get("X-Slack-Request-Timestamp")+":"), body...)
+	},
+}
+
+// WebhookVerifierOption Option for WebhookVerifier
+type WebhookVerifierOption func(*WebhookVerifier)
+
+// WithWebhookMaxBodySize Largest accepted body. Defaults to 25 MiB, the largest GitHub delivery
+func WithWebhookMaxBodySize(size int64) WebhookVerifierOption {
+	return func(verifier *WebhookVerifier) {
+		verifier.maxBodySize = size
+	}
+}
+
+// WithWebhookMaxAge Largest accepted difference between the delivery timestamp and now, for schemes with a timestamp header.
+// Defaults to 5 minutes
+func WithWebhookMaxAge(maxAge time.Duration) WebhookVerifierOption {
+	return func(verifier *WebhookVerifier) {
+		verifier.maxAge = maxAge
+	}
+}
+
+// WithWebhookClock Clock used to reject stale deliveries
+func WithWebhookClock(clock utils.Clock) WebhookVerifierOption {
+	return func(verifier *WebhookVerifier) {
+		verifier.clock = clock
+	}
+}
+
+// WebhookVerifier Verifies HMAC-SHA256 signatures of webhook deliveries.
+// Several secrets can be configured, so a secret can be rotated without rejecting deliveries
+type WebhookVerifier struct {
+	scheme      WebhookScheme
+	secrets     [][]byte
+	maxBodySize int64
+	maxAge      time.Duration
+	clock       utils.Clock
+}
+
+// NewWebhookVerifier Constructor for WebhookVerifier. Panics when the scheme has a timestamp header without a SignedPayload,
+// since an unsigned timestamp can be replaced to replay stale deliveries.
+// Also panics when there are no secrets or a secret is empty, e.g. from an unset environment variable,
+// since anyone can sign a delivery with an empty secret
+func NewWebhookVerifier(scheme WebhookScheme, secrets [][]byte, options ...WebhookVerifierOption) *WebhookVerifier {
+	if len(scheme.TimestampHeader) > 0 && scheme.SignedPayload == nil {
+		panic(fmt.Sprintf("webhook: scheme with timestamp header %q must sign the timestamp with SignedPayload", scheme.TimestampHeader))
+	}
+	if len(secrets) == 0 {
+		panic("webhook: at least one secret is required")
+	}
+	for _, secret := range secrets {
+		if len(secret) == 0 {
+			panic("webhook: secrets must not be empty")
+		}
+	}
+	verifier := &WebhookVerifier{
+		scheme:      scheme,
+		secrets:     secrets,
+		maxBodySize: defaultWebhookMaxBodySize,
+		maxAge:      defaultWebhookMaxAge,
+		clock:       utils.RealClock{},
+	}
+	for _, option := range options {
+		option(verifier)
+	}
+	return verifier
+}
+
+// Verify Reads the body and verifies the signature of the request. The body is restored, so the handler can read it.
+// Missing or malformed headers and too large bodies are returned as ValidationError,
+// while invalid signatures and stale deliveries are returned as ForbiddenError
+func (verifier *WebhookVerifier) Verify(r *http.Request) error {
+	signature, err := verifier.signature(r)
+	if err != nil {
+		return err
+	}
+	if err := verifier.verifyTimestamp(r); err != nil {
+		return err
+	}
+
+	body, err := verifier.readBody(r)
+	if err != nil {
+		return err
+	}
+
+	payload := body
+	if verifier.scheme.SignedPayload != nil {
+		payload = verifier.scheme.SignedPayload(r, body)
+	}
+	for _, secret := range verifier.secrets {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(payload)
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return nil
+		}
+	}
+	return ForbiddenError("The webhook signature is not valid")
+}
+
+// Handler Verifies the signature of requests before calling next, and answers failed verifications with ErrorResponse
+func (verifier *WebhookVerifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := verifier.Verify(r); err != nil {
+			zerolog.Ctx(r.Context()).Info().Err(err).Msg("webhook delivery rejected")
+			if err := ErrorResponse(w, r, err); err != nil {
+				zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to write webhook error response")
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (verifier *WebhookVerifier) signature(r *http.Request) ([]byte, error) {
+	header := verifier.scheme.SignatureHeader
+	value, ok := strings.CutPrefix(r.Header.Get(header), verifier.scheme.SignaturePrefix)
+	if !ok || len(value) == 0 {
+		return nil, ValidationError(header, fmt.Sprintf("The %s header is missing or malformed", header))
+	}
+
+	var signature []byte
+	var err error
+	if verifier.scheme.Base64 {
+		signature, err = base64.StdEncoding.DecodeString(value)
+	} else {
+		signature, err = hex.DecodeString(value)
+	}
+	if err != nil {
+		return nil, ValidationError(header, fmt.Sprintf("The %s header is missing or malformed", header))
+	}
+	return signature, nil
+}
+
+func (verifier *WebhookVerifier) verifyTimestamp(r *http.Request) error {
+	header := verifier.scheme.TimestampHeader
+	if len(header) == 0 {
+		return nil
+	}
+
+	seconds, err := strconv.ParseInt(r.Header.Get(header), 10, 64)
+	if err != nil {
+		return ValidationError(header, fmt.Sprintf("The %s header is missing or malformed", header))
+	}
+	if age := verifier.clock.Now().Sub(time.Unix(seconds, 0)); age > verifier.maxAge || age < -verifier.maxAge {
+		return ForbiddenError("The webhook delivery is stale")
+	}
+	return nil
+}
+
+// readBody Reads the body under the size cap, and restores it for the handler
+func (verifier *WebhookVerifier) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, verifier.maxBodySize+1))
+	_ = r.Body.Close()
+	if err != nil {
+		return nil, UnexpectedError("Unable to read the webhook body", err)
+	}
+	if int64(len(body)) > verifier.maxBodySize {
+		return nil, ValidationError("Body", "The webhook body is too large")
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func signWebhookPayload(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func Test_WebhookVerifier_GitHub(t *testing.T) {
+	const body = `{"ref":"refs/heads/main"}`
+	var received string
+	sut := NewWebhookVerifier(GitHubWebhookScheme, [][]byte{[]byte("new-secret"), []byte("old-secret")}, WithWebhookMaxBodySize(100)).
+		Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			received = string(b)
+		}))
+
+	tests := map[string]struct {
+		signature    string
+		body         string
+		expectedCode int
+	}{
+		"current secret":    {signature: "sha256=" + signWebhookPayload("new-secret", body), body: body, expectedCode: http.StatusOK},
+		"previous secret":   {signature: "sha256=" + signWebhookPayload("old-secret", body), body: body, expectedCode: http.StatusOK},
+		"unknown secret":    {signature: "sha256=" + signWebhookPayload("other-secret", body), body: body, expectedCode: http.StatusForbidden},
+		"modified body":     {signature: "sha256=" + signWebhookPayload("new-secret", body), body: body + " ", expectedCode: http.StatusForbidden},
+		"missing signature": {body: body, expectedCode: http.StatusBadRequest},
+		"sha1 signature":    {signature: "sha1=" + signWebhookPayload("new-secret", body), body: body, expectedCode: http.StatusBadRequest},
+		"malformed hex":     {signature: "sha256=not-hex", body: body, expectedCode: http.StatusBadRequest},
+		"too large body":    {signature: "sha256=" + signWebhookPayload("new-secret", strings.Repeat("x", 101)), body: strings.Repeat("x", 101), expectedCode: http.StatusBadRequest},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			received = ""
+			req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(test.body))
+			req.Header.Set("Accept", "application/json")
+			if len(test.signature) > 0 {
+				req.Header.Set("X-Hub-Signature-256", test.signature)
+			}
+			w := httptest.NewRecorder()
+			sut.ServeHTTP(w, req)
+
+			assert.Equal(t, test.expectedCode, w.Code)
+			if test.expectedCode == http.StatusOK {
+				assert.Equal(t, test.body, received, "Body is restored for the handler")
+			} else {
+				assert.Empty(t, received)
+			}
+		})
+	}
+}
+
+func Test_WebhookVerifier_Timestamp(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sut := NewWebhookVerifier(SlackWebhookScheme, [][]byte{[]byte("secret")}, WithWebhookClock(utils.NewFakeClock(now)))
+	newRequest := func(timestamp time.Time) *http.Request {
+		const body = "token=abc&command=/radix"
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/slack", strings.NewReader(body))
+		req.Header.Set("X-Slack-Request-Timestamp", ts)
+		req.Header.Set("X-Slack-Signature", "v0="+signWebhookPayload("secret", "v0:"+ts+":"+body))
+		return req
+	}
+
+	assert.NoError(t, sut.Verify(newRequest(now.Add(-time.Minute))))
+	assertForbidden(t, sut.Verify(newRequest(now.Add(-10*time.Minute))), "Stale deliveries are rejected")
+	assertForbidden(t, sut.Verify(newRequest(now.Add(10*time.Minute))), "Deliveries from the future are rejected")
+
+	req := newRequest(now)
+	req.Header.Set("X-Slack-Request-Timestamp", strconv.FormatInt(now.Add(time.Second).Unix(), 10))
+	assertForbidden(t, sut.Verify(req), "Timestamp is signed")
+}
+
+func Test_WebhookVerifier_UnsignedTimestamp(t *testing.T) {
+	scheme := WebhookScheme{SignatureHeader: "X-Signature", TimestampHeader: "X-Timestamp"}
+	assert.Panics(t, func() {
+		NewWebhookVerifier(scheme, [][]byte{[]byte("secret")})
+	}, "A timestamp that is not signed can be replaced")
+}
+
+func Test_WebhookVerifier_EmptySecret(t *testing.T) {
+	assert.Panics(t, func() { NewWebhookVerifier(GitHubWebhookScheme, nil) }, "No secrets")
+	assert.Panics(t, func() { NewWebhookVerifier(GitHubWebhookScheme, [][]byte{[]byte("secret"), []byte("")}) }, "Anyone can sign with an empty secret")
+}
+
+func assertForbidden(t *testing.T, err error, msg string) {
+	var apiErr *Error
+	if assert.ErrorAs(t, err, &apiErr, msg) {
+		assert.Equal(t, Type(Forbidden), apiErr.Type, msg)
+	}
+}
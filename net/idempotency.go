@@ -0,0 +1,372 @@
+package net
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/equinor/radix-common/utils"
+	"github.com/rs/zerolog"
+)
+
+const (
+	idempotencyKeyHeader          = "Idempotency-Key"
+	idempotentReplayedHeader      = "Idempotent-Replayed"
+	maxIdempotencyKeySize         = 255
+	defaultIdempotencyTTL         = 24 * time.Hour
+	defaultIdempotencyMaxBody     = 10 << 20
+	defaultIdempotencyMaxResponse = 64 << 10
+	defaultMaxIdempotencyRecords  = 10_000
+)
+
+// IdempotentResponse Response stored for an idempotency key
+type IdempotentResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyRecord State of an idempotency key
+type IdempotencyRecord struct {
+	// RequestDigest Digest of the method, URL and body of the first request with the key
+	RequestDigest string
+	// Response The response of the first request, or nil while the request is in flight
+	Response  *IdempotentResponse
+	ExpiresAt time.Time
+}
+
+// IdempotencyStore Holds the records of idempotency keys
+type IdempotencyStore interface {
+	// Reserve Stores the record for the key when the key is not in use, and returns true.
+	// Otherwise the existing record is returned with false
+	Reserve(key string, record IdempotencyRecord, now time.Time) (IdempotencyRecord, bool)
+	// Complete Stores the response for the reserved key
+	Complete(key string, response IdempotentResponse, expiresAt time.Time)
+	// Release Removes the key, so the request can be retried
+	Release(key string)
+}
+
+type idempotencyEntry struct {
+	key    string
+	record IdempotencyRecord
+}
+
+// MemoryIdempotencyStoreOption Option for MemoryIdempotencyStore
+type MemoryIdempotencyStoreOption func(*MemoryIdempotencyStore)
+
+// WithMaxIdempotencyRecords Max number of records kept in the store. Defaults to 10 000
+func WithMaxIdempotencyRecords(maxRecords int) MemoryIdempotencyStoreOption {
+	return func(store *MemoryIdempotencyStore) {
+		store.maxRecords = maxRecords
+	}
+}
+
+// MemoryIdempotencyStore In-memory IdempotencyStore, evicting expired records.
+// When the store is full, the least recently updated record is evicted for a new key
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*list.Element
+	// recent Records ordered from the most to the least recently updated, i.e. by expiry when the TTL is the same for all keys
+	recent     *list.List
+	maxRecords int
+}
+
+// NewMemoryIdempotencyStore Constructor for MemoryIdempotencyStore. A non-positive max number of records defaults to 10 000
+func NewMemoryIdempotencyStore(options ...MemoryIdempotencyStoreOption) *MemoryIdempotencyStore {
+	store := &MemoryIdempotencyStore{
+		records:    map[string]*list.Element{},
+		recent:     list.New(),
+		maxRecords: defaultMaxIdempotencyRecords,
+	}
+	for _, option := range options {
+		option(store)
+	}
+	if store.maxRecords <= 0 {
+		store.maxRecords = defaultMaxIdempotencyRecords
+	}
+	return store
+}
+
+// Reserve Stores the record for the key when the key is not in use or expired
+func (store *MemoryIdempotencyStore) Reserve(key string, record IdempotencyRecord, now time.Time) (IdempotencyRecord, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.evictExpiredRecords(now)
+	if element, ok := store.records[key]; ok {
+		entry := element.Value.(*idempotencyEntry)
+		if now.Before(entry.record.ExpiresAt) {
+			return entry.record, false
+		}
+		store.removeRecord(element)
+	}
+	if store.recent.Len() >= store.maxRecords {
+		store.removeRecord(store.recent.Back())
+	}
+	store.records[key] = store.recent.PushFront(&idempotencyEntry{key: key, record: record})
+	return record, true
+}
+
+// Complete Stores the response for the key
+func (store *MemoryIdempotencyStore) Complete(key string, response IdempotentResponse, expiresAt time.Time) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if element, ok := store.records[key]; ok {
+		entry := element.Value.(*idempotencyEntry)
+		entry.record.Response = &response
+		entry.record.ExpiresAt = expiresAt
+		store.recent.MoveToFront(element)
+	}
+}
+
+// Release Removes the key
+func (store *MemoryIdempotencyStore) Release(key string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if element, ok := store.records[key]; ok {
+		store.removeRecord(element)
+	}
+}
+
+// Len Number of records in the store
+func (store *MemoryIdempotencyStore) Len() int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return len(store.records)
+}
+
+// evictExpiredRecords Removes expired records from the least recently updated end, stopping at the first record not expired
+func (store *MemoryIdempotencyStore) evictExpiredRecords(now time.Time) {
+	for element := store.recent.Back(); element != nil; element = store.recent.Back() {
+		if now.Before(element.Value.(*idempotencyEntry).record.ExpiresAt) {
+			return
+		}
+		store.removeRecord(element)
+	}
+}
+
+func (store *MemoryIdempotencyStore) removeRecord(element *list.Element) {
+	entry := store.recent.Remove(element).(*idempotencyEntry)
+	delete(store.records, entry.key)
+}
+
+// IdempotencyOption Option for Idempotency
+type IdempotencyOption func(*Idempotency)
+
+// WithIdempotencyTTL Time a key is reserved and its response replayed. Defaults to 24 hours
+func WithIdempotencyTTL(ttl time.Duration) IdempotencyOption {
+	return func(idempotency *Idempotency) {
+		idempotency.ttl = ttl
+	}
+}
+
+// WithIdempotencyMaxBodySize Largest request body accepted with an idempotency key. Defaults to 10 MiB
+func WithIdempotencyMaxBodySize(size int64) IdempotencyOption {
+	return func(idempotency *Idempotency) {
+		idempotency.maxBodySize = size
+	}
+}
+
+// WithIdempotencyMaxResponseSize Largest response body stored for replay. Defaults to 64 KiB.
+// Larger responses are not stored, so the key is released and a retry runs the request again
+func WithIdempotencyMaxResponseSize(size int64) IdempotencyOption {
+	return func(idempotency *Idempotency) {
+		idempotency.maxResponseSize = size
+	}
+}
+
+// WithIdempotencyClock Clock used for the expiry of keys
+func WithIdempotencyClock(clock utils.Clock) IdempotencyOption {
+	return func(idempotency *Idempotency) {
+		idempotency.clock = clock
+	}
+}
+
+// Idempotency Honors the Idempotency-Key header of POST requests, scoped to the caller.
+// WithTokenVerifier is required to scope keys to the principal: without it, keys are scoped to the bearer token,
+// so a retry with a refreshed token, e.g. by a pipeline, is not recognized and the request is run again.
+// The first response for a key is stored and replayed for retries of the same request.
+// Retries while the first request is in flight are answered with 409 Conflict, and reuse of the key
+// for a different request with 422 Unprocessable Entity. Server errors and responses larger than the max response size
+// are not stored, so the request can be retried
+type Idempotency struct {
+	store           IdempotencyStore
+	ttl             time.Duration
+	maxBodySize     int64
+	maxResponseSize int64
+	clock           utils.Clock
+}
+
+// NewIdempotency Constructor for Idempotency
+func NewIdempotency(store IdempotencyStore, options ...IdempotencyOption) *Idempotency {
+	idempotency := &Idempotency{
+		store:           store,
+		ttl:             defaultIdempotencyTTL,
+		maxBodySize:     defaultIdempotencyMaxBody,
+		maxResponseSize: defaultIdempotencyMaxResponse,
+		clock:           utils.RealClock{},
+	}
+	for _, option := range options {
+		option(idempotency)
+	}
+	return idempotency
+}
+
+// Middleware Applies the idempotency key of POST requests
+func (idempotency *Idempotency) Middleware() models.Middleware {
+	return func(next models.RadixHandlerFunc) models.RadixHandlerFunc {
+		return func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+			idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+			if r.Method != http.MethodPost || len(idempotencyKey) == 0 {
+				next(accounts, w, r)
+				return
+			}
+			logger := zerolog.Ctx(r.Context())
+
+			digest, err := idempotency.requestDigest(r, idempotencyKey)
+			if err != nil {
+				if err := httpUtils.ErrorResponse(w, r, err); err != nil {
+					logger.Error().Err(err).Msg("unable to write idempotency error response")
+				}
+				return
+			}
+
+			key := idempotencyScope(accounts, r) + "|" + idempotencyKey
+			now := idempotency.clock.Now()
+			record, reserved := idempotency.store.Reserve(key, IdempotencyRecord{RequestDigest: digest, ExpiresAt: now.Add(idempotency.ttl)}, now)
+			if !reserved {
+				if err := idempotency.replay(w, r, record, digest); err != nil {
+					logger.Error().Err(err).Msg("unable to write idempotent response")
+				}
+				return
+			}
+
+			completed := false
+			defer func() {
+				if !completed {
+					idempotency.store.Release(key)
+				}
+			}()
+
+			headerBefore := w.Header().Clone()
+			recorder := &idempotencyRecorder{ResponseRecorder: NewResponseRecorder(w), maxSize: idempotency.maxResponseSize}
+			next(accounts, recorder, r)
+
+			status := recorder.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError || recorder.truncated {
+				return
+			}
+			idempotency.store.Complete(key, IdempotentResponse{
+				Status: status,
+				Header: changedHeaders(headerBefore, w.Header()),
+				Body:   recorder.body.Bytes(),
+			}, idempotency.clock.Now().Add(idempotency.ttl))
+			completed = true
+		}
+	}
+}
+
+// requestDigest Reads the body, and returns the digest of the method, URL and body.
+// The body is replaced, so the handler can read it
+func (idempotency *Idempotency) requestDigest(r *http.Request, idempotencyKey string) (string, error) {
+	if len(idempotencyKey) > maxIdempotencyKeySize || !isPrintableASCII(idempotencyKey) {
+		return "", httpUtils.ValidationError("Idempotency-Key", "The Idempotency-Key header must be at most 255 printable ASCII characters")
+	}
+
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, idempotency.maxBodySize+1))
+		if err != nil {
+			return "", err
+		}
+		if int64(len(body)) > idempotency.maxBodySize {
+			return "", httpUtils.ValidationError("Idempotency-Key", "The request body is too large for a request with an Idempotency-Key header")
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (idempotency *Idempotency) replay(w http.ResponseWriter, r *http.Request, record IdempotencyRecord, digest string) error {
+	switch {
+	case record.RequestDigest != digest:
+		return httpUtils.ErrorResponse(w, r, httpUtils.UnprocessableEntityError("The Idempotency-Key is already used for a different request"))
+	case record.Response == nil:
+		return httpUtils.ErrorResponse(w, r, httpUtils.ConflictError("A request with the same Idempotency-Key is in progress"))
+	}
+
+	header := w.Header()
+	for name, values := range record.Response.Header {
+		header[name] = slices.Clone(values)
+	}
+	header.Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(record.Response.Status)
+	_, err := w.Write(record.Response.Body)
+	return err
+}
+
+// idempotencyScope Scope of the idempotency keys of the caller: the verified principal, the SHA-256 of an unverified bearer token,
+// or the client IP for anonymous requests. Unverified claims are never used, so a caller cannot replay the responses
+// of another caller by forging a token with the same upn
+func idempotencyScope(accounts models.Accounts, r *http.Request) string {
+	if principal, ok := accounts.GetAuthenticatedPrincipal(); ok {
+		return "principal:" + principal
+	}
+	if token := accounts.GetToken(); len(token) > 0 {
+		digest := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(digest[:])
+	}
+	return "ip:" + remoteIP(r)
+}
+
+// changedHeaders The headers set by the handler, excluding headers set before the handler was called, e.g. X-Request-Id
+func changedHeaders(before, after http.Header) http.Header {
+	changed := http.Header{}
+	for name, values := range after {
+		if !slices.Equal(before[name], values) {
+			changed[name] = slices.Clone(values)
+		}
+	}
+	return changed
+}
+
+// idempotencyRecorder Records the response body up to the max size, in addition to the status recorded by ResponseRecorder
+type idempotencyRecorder struct {
+	*ResponseRecorder
+	body      bytes.Buffer
+	maxSize   int64
+	truncated bool
+}
+
+func (rec *idempotencyRecorder) Write(p []byte) (int, error) {
+	n, err := rec.ResponseRecorder.Write(p)
+	if !rec.truncated {
+		if int64(rec.body.Len()+n) > rec.maxSize {
+			rec.truncated = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(p[:n])
+		}
+	}
+	return n, err
+}
+
+func (rec *idempotencyRecorder) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(writerOnly{rec}, r)
+}
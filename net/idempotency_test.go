@@ -0,0 +1,224 @@
+package net
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	"github.com/equinor/radix-common/utils"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIdempotencyTestRouter(idempotency *Idempotency, handler models.RadixHandlerFunc) *Router {
+	return NewRouter(nil, WithMiddlewares(idempotency.Middleware()), WithTraceContext()).AddRoutes(models.Routes{
+		{Path: "/jobs", Method: http.MethodPost, HandlerFunc: handler},
+	})
+}
+
+func newIdempotencyTestRequest(t *testing.T, upn, key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+newTestToken(t, jwt.MapClaims{"upn": upn}))
+	req.Header.Set("Accept", "application/json")
+	if len(key) > 0 {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	return req
+}
+
+func Test_Idempotency_ReplaysResponse(t *testing.T) {
+	var calls atomic.Int32
+	clock := utils.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryIdempotencyStore()
+	sut := newIdempotencyTestRouter(NewIdempotency(store, WithIdempotencyTTL(time.Hour), WithIdempotencyClock(clock)), func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n := calls.Add(1)
+		w.Header().Set("Location", "/jobs/"+strconv.Itoa(int(n)))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(append([]byte("job for "), body...))
+	})
+
+	first := httptest.NewRecorder()
+	sut.ServeHTTP(first, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Equal(t, "job for payload", first.Body.String())
+
+	retry := httptest.NewRecorder()
+	sut.ServeHTTP(retry, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "job for payload", retry.Body.String())
+	assert.Equal(t, "/jobs/1", retry.Header().Get("Location"))
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.NotEqual(t, first.Header().Get("X-Request-Id"), retry.Header().Get("X-Request-Id"), "Headers set outside the handler are not replayed")
+	assert.Equal(t, int32(1), calls.Load())
+
+	other := httptest.NewRecorder()
+	sut.ServeHTTP(other, newIdempotencyTestRequest(t, "user2@equinor.com", "key1", "payload"))
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.Empty(t, other.Header().Get("Idempotent-Replayed"), "Keys are scoped to the principal")
+
+	sut.ServeHTTP(httptest.NewRecorder(), newIdempotencyTestRequest(t, "user1@equinor.com", "", "payload"))
+	assert.Equal(t, int32(3), calls.Load(), "Requests without a key are not deduplicated")
+
+	clock.Advance(time.Hour)
+	expired := httptest.NewRecorder()
+	sut.ServeHTTP(expired, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	assert.Equal(t, "/jobs/4", expired.Header().Get("Location"), "Expired keys are reused")
+}
+
+func Test_Idempotency_ScopedToVerifiedPrincipal(t *testing.T) {
+	request := func(token string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader("payload"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Idempotency-Key", "key1")
+		return req
+	}
+	handler := func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	t.Run("unverified tokens with the same upn", func(t *testing.T) {
+		sut := newIdempotencyTestRouter(NewIdempotency(NewMemoryIdempotencyStore()), handler)
+		sut.ServeHTTP(httptest.NewRecorder(), request(newTestTokenWithKey(t, "key-a", jwt.MapClaims{"upn": "user1@equinor.com"})))
+
+		forged := httptest.NewRecorder()
+		sut.ServeHTTP(forged, request(newTestTokenWithKey(t, "key-b", jwt.MapClaims{"upn": "user1@equinor.com"})))
+		assert.Equal(t, http.StatusCreated, forged.Code)
+		assert.Empty(t, forged.Header().Get("Idempotent-Replayed"), "Unverified claims do not scope the key")
+	})
+
+	t.Run("verified tokens with the same upn", func(t *testing.T) {
+		verifier := models.JWTTokenVerifier(func(*jwt.Token) (interface{}, error) { return []byte("key-a"), nil }, jwt.WithValidMethods([]string{"HS256"}))
+		idempotency := NewIdempotency(NewMemoryIdempotencyStore())
+		sut := NewRouter(nil, WithTokenVerifier(verifier), WithMiddlewares(idempotency.Middleware())).AddRoutes(models.Routes{
+			{Path: "/jobs", Method: http.MethodPost, HandlerFunc: handler},
+		})
+		sut.ServeHTTP(httptest.NewRecorder(), request(newTestTokenWithKey(t, "key-a", jwt.MapClaims{"upn": "user1@equinor.com"})))
+
+		forged := httptest.NewRecorder()
+		sut.ServeHTTP(forged, request(newTestTokenWithKey(t, "key-b", jwt.MapClaims{"upn": "user1@equinor.com"})))
+		assert.Equal(t, http.StatusUnauthorized, forged.Code)
+		assert.Empty(t, forged.Header().Get("Idempotent-Replayed"))
+
+		reissued := httptest.NewRecorder()
+		sut.ServeHTTP(reissued, request(newTestTokenWithKey(t, "key-a", jwt.MapClaims{"upn": "user1@equinor.com", "iat": 1})))
+		assert.Equal(t, "true", reissued.Header().Get("Idempotent-Replayed"), "A new token of the verified principal shares the key")
+	})
+}
+
+func Test_Idempotency_DifferentPayload(t *testing.T) {
+	sut := newIdempotencyTestRouter(NewIdempotency(NewMemoryIdempotencyStore()), func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	sut.ServeHTTP(httptest.NewRecorder(), newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "other payload"))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"type":"unprocessable"`)
+}
+
+func Test_Idempotency_InFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	sut := newIdempotencyTestRouter(NewIdempotency(NewMemoryIdempotencyStore()), func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sut.ServeHTTP(httptest.NewRecorder(), newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	}()
+	<-started
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"type":"conflict"`)
+	close(release)
+	<-done
+}
+
+func Test_Idempotency_ServerErrorsAreNotStored(t *testing.T) {
+	var calls atomic.Int32
+	store := NewMemoryIdempotencyStore()
+	sut := newIdempotencyTestRouter(NewIdempotency(store), func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, 0, store.Len())
+
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func Test_Idempotency_LargeResponsesAreNotStored(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	sut := newIdempotencyTestRouter(NewIdempotency(store, WithIdempotencyMaxResponseSize(4)), func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("abc"))
+		_, _ = w.Write([]byte("def"))
+	})
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "abcdef", w.Body.String(), "The response is not truncated")
+	assert.Equal(t, 0, store.Len())
+}
+
+func Test_MemoryIdempotencyStore_MaxRecords(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := IdempotencyRecord{RequestDigest: "any", ExpiresAt: now.Add(time.Hour)}
+	sut := NewMemoryIdempotencyStore(WithMaxIdempotencyRecords(2))
+
+	sut.Reserve("oldest", record, now)
+	sut.Reserve("any", record, now)
+	sut.Complete("oldest", IdempotentResponse{Status: http.StatusCreated}, now.Add(time.Hour))
+	sut.Reserve("other", record, now)
+	assert.Equal(t, 2, sut.Len())
+	_, reserved := sut.Reserve("oldest", record, now)
+	assert.False(t, reserved, "Recently completed records are kept")
+	_, reserved = sut.Reserve("any", record, now)
+	assert.True(t, reserved, "The least recently updated record is evicted")
+}
+
+func Test_MemoryIdempotencyStore_EvictsExpiredRecords(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sut := NewMemoryIdempotencyStore()
+
+	sut.Reserve("any", IdempotencyRecord{ExpiresAt: now.Add(time.Minute)}, now)
+	sut.Reserve("other", IdempotencyRecord{ExpiresAt: now.Add(2 * time.Minute)}, now.Add(time.Second))
+	require.Equal(t, 2, sut.Len())
+
+	sut.Reserve("new", IdempotencyRecord{ExpiresAt: now.Add(3 * time.Minute)}, now.Add(time.Minute))
+	assert.Equal(t, 2, sut.Len())
+}
+
+func Test_Idempotency_InvalidKey(t *testing.T) {
+	sut := newIdempotencyTestRouter(NewIdempotency(NewMemoryIdempotencyStore()), func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, newIdempotencyTestRequest(t, "user1@equinor.com", strings.Repeat("k", 256), "payload"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
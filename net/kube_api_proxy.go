@@ -0,0 +1,294 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// maxStatusBodySize Max size of an upstream error body that is parsed as a Kubernetes Status
+const maxStatusBodySize = 1 << 20
+
+// KubeAPICredentialPolicy Defines which credentials are sent to the Kubernetes API
+type KubeAPICredentialPolicy int
+
+const (
+	// ForwardUserCredentials Forwards the bearer token and the impersonation requested by the caller
+	ForwardUserCredentials KubeAPICredentialPolicy = iota
+	// ServiceCredentialsWithImpersonation Replaces the caller's bearer token with the service token,
+	// and impersonates the caller with the user principal name and groups returned by the KubeAPICallerVerifier
+	ServiceCredentialsWithImpersonation
+)
+
+// KubeAPICaller Verified identity of the caller, impersonated when proxying with service credentials
+type KubeAPICaller struct {
+	User   string
+	Groups []string
+}
+
+// KubeAPICallerVerifier Verifies the caller's bearer token and returns the identity of the caller,
+// e.g. with a TokenReview or by validating the token signature, see JWTCallerVerifier
+type KubeAPICallerVerifier func(ctx context.Context, token string) (KubeAPICaller, error)
+
+// JWTCallerVerifier Verifies the signature and lifetime of the caller's JWT with the key function,
+// and returns the upn and groups claims. Tokens without a upn claim are rejected
+func JWTCallerVerifier(keyFunc jwt.Keyfunc, options ...jwt.ParserOption) KubeAPICallerVerifier {
+	verify := models.JWTTokenVerifier(keyFunc, options...)
+	return func(ctx context.Context, token string) (KubeAPICaller, error) {
+		claims, err := verify(ctx, token)
+		if err != nil {
+			return KubeAPICaller{}, err
+		}
+		user, ok := claims["upn"].(string)
+		if !ok || len(user) == 0 {
+			return KubeAPICaller{}, errors.New("token has no upn claim")
+		}
+		var groups []string
+		if rawGroups, ok := claims["groups"].([]interface{}); ok {
+			for _, group := range rawGroups {
+				if group, ok := group.(string); ok {
+					groups = append(groups, group)
+				}
+			}
+		}
+		return KubeAPICaller{User: user, Groups: groups}, nil
+	}
+}
+
+// KubeAPIProxyOption Option for the Kubernetes API proxy
+type KubeAPIProxyOption func(*KubeAPIProxy)
+
+// KubeAPIProxy Reverse proxy to the Kubernetes API, authenticating the caller with models.Accounts
+type KubeAPIProxy struct {
+	target       *url.URL
+	pathPrefix   string
+	policy       KubeAPICredentialPolicy
+	serviceToken func(context.Context) (string, error)
+	verifyCaller KubeAPICallerVerifier
+	proxy        *httputil.ReverseProxy
+}
+
+// WithKubeAPITransport Sets the transport used to reach the Kubernetes API, e.g. with the cluster CA
+func WithKubeAPITransport(transport http.RoundTripper) KubeAPIProxyOption {
+	return func(p *KubeAPIProxy) {
+		p.proxy.Transport = transport
+	}
+}
+
+// WithKubeAPIPathPrefix Strips the prefix from the request path before it is sent to the Kubernetes API.
+// Requests with a path outside the prefix are answered with 404 Not Found
+func WithKubeAPIPathPrefix(prefix string) KubeAPIProxyOption {
+	return func(p *KubeAPIProxy) {
+		p.pathPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithServiceCredentials Replaces the caller's credentials with the token returned by serviceToken,
+// and impersonates the caller verified by verifyCaller. The claims of the caller's token are never trusted
+// without verification, and requests are denied when verifyCaller is nil. Panics when serviceToken is nil
+func WithServiceCredentials(serviceToken func(context.Context) (string, error), verifyCaller KubeAPICallerVerifier) KubeAPIProxyOption {
+	if serviceToken == nil {
+		panic("kube api proxy: service credentials require a service token function")
+	}
+	return func(p *KubeAPIProxy) {
+		p.policy = ServiceCredentialsWithImpersonation
+		p.serviceToken = serviceToken
+		p.verifyCaller = verifyCaller
+	}
+}
+
+// NewKubeAPIProxy Constructor for the Kubernetes API proxy
+func NewKubeAPIProxy(target *url.URL, options ...KubeAPIProxyOption) *KubeAPIProxy {
+	p := &KubeAPIProxy{
+		target: target,
+		policy: ForwardUserCredentials,
+	}
+	p.proxy = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		FlushInterval:  -1, // Flush immediately to stream watch responses
+		ModifyResponse: modifyKubeAPIResponse,
+		ErrorHandler:   kubeAPIErrorHandler,
+	}
+
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// Handle Proxies the request to the Kubernetes API. Can be used as a models.RadixHandlerFunc
+func (p *KubeAPIProxy) Handle(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+	logger := zerolog.Ctx(r.Context())
+
+	outReq := r.Clone(r.Context())
+	removeCredentialHeaders(outReq.Header)
+
+	if !p.stripPathPrefix(outReq.URL) {
+		if err := httpUtils.ErrorResponse(w, r, httpUtils.NotFoundError("Not found")); err != nil {
+			logger.Error().Err(err).Msg("unable to write proxy not found response")
+		}
+		return
+	}
+
+	if err := p.setCredentialHeaders(outReq, accounts); err != nil {
+		if err := httpUtils.ErrorResponse(w, r, err); err != nil {
+			logger.Error().Err(err).Msg("unable to write proxy auth error response")
+		}
+		return
+	}
+
+	p.proxy.ServeHTTP(w, outReq)
+}
+
+func (p *KubeAPIProxy) setCredentialHeaders(r *http.Request, accounts models.Accounts) error {
+	switch p.policy {
+	case ServiceCredentialsWithImpersonation:
+		if accounts.GetImpersonation().PerformImpersonation() {
+			return httpUtils.ForbiddenError("Impersonation is not allowed when proxying with service credentials")
+		}
+		if p.verifyCaller == nil {
+			return httpUtils.UnexpectedError("Unable to verify the caller", errors.New("service credentials require a caller verifier"))
+		}
+		if len(accounts.GetToken()) == 0 {
+			return httpUtils.UnauthorizedError("Missing bearer token")
+		}
+		caller, err := p.verifyCaller(r.Context(), accounts.GetToken())
+		if err != nil {
+			zerolog.Ctx(r.Context()).Info().Err(err).Msg("caller verification failed")
+			return httpUtils.UnauthorizedError("Unable to identify the caller")
+		}
+		if len(caller.User) == 0 {
+			return httpUtils.UnauthorizedError("Unable to identify the caller")
+		}
+		token, err := p.serviceToken(r.Context())
+		if err != nil {
+			return httpUtils.UnexpectedError("Unable to get service credentials", err)
+		}
+
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("Impersonate-User", caller.User)
+		for _, group := range caller.Groups {
+			r.Header.Add("Impersonate-Group", group)
+		}
+	default:
+		if len(accounts.GetToken()) == 0 {
+			return httpUtils.UnauthorizedError("Missing bearer token")
+		}
+
+		r.Header.Set("Authorization", "Bearer "+accounts.GetToken())
+		if impersonation := accounts.GetImpersonation(); impersonation.PerformImpersonation() {
+			r.Header.Set("Impersonate-User", impersonation.User)
+			for _, group := range impersonation.Groups {
+				r.Header.Add("Impersonate-Group", group)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *KubeAPIProxy) rewrite(pr *httputil.ProxyRequest) {
+	pr.SetURL(p.target)
+}
+
+// stripPathPrefix Removes the path prefix from the path and raw path of the URL.
+// Returns false when a path is outside the prefix, e.g. /apis or /apifoo for the prefix /api
+func (p *KubeAPIProxy) stripPathPrefix(u *url.URL) bool {
+	if len(p.pathPrefix) == 0 {
+		return true
+	}
+	path, ok := trimPathPrefix(u.Path, p.pathPrefix)
+	if !ok {
+		return false
+	}
+	if len(u.RawPath) > 0 {
+		rawPath, ok := trimPathPrefix(u.RawPath, p.pathPrefix)
+		if !ok {
+			return false
+		}
+		u.RawPath = rawPath
+	}
+	u.Path = path
+	return true
+}
+
+// trimPathPrefix Removes the prefix when it is followed by / or ends the path
+func trimPathPrefix(path, prefix string) (string, bool) {
+	rest, ok := strings.CutPrefix(path, prefix)
+	switch {
+	case !ok:
+		return "", false
+	case len(rest) == 0:
+		return "/", true
+	case rest[0] == '/':
+		return rest, true
+	default:
+		return "", false
+	}
+}
+
+// removeCredentialHeaders Removes headers that can change the identity used for the Kubernetes API
+func removeCredentialHeaders(header http.Header) {
+	for name := range header {
+		canonicalName := http.CanonicalHeaderKey(name)
+		if canonicalName == "Authorization" || strings.HasPrefix(canonicalName, "Impersonate-") {
+			header.Del(name)
+		}
+	}
+}
+
+// modifyKubeAPIResponse Converts Kubernetes Status failure responses to errors handled by kubeAPIErrorHandler
+func modifyKubeAPIResponse(resp *http.Response) error {
+	if resp.StatusCode < http.StatusBadRequest {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxStatusBodySize))
+	if err != nil {
+		return err
+	}
+
+	var status metav1.Status
+	if err := json.Unmarshal(body, &status); err == nil && status.Kind == "Status" {
+		_ = resp.Body.Close()
+		if status.Code == 0 {
+			status.Code = int32(resp.StatusCode)
+		}
+		return &k8serrors.StatusError{ErrStatus: status}
+	}
+
+	resp.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), resp.Body), Closer: resp.Body}
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func kubeAPIErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	var statusErr *k8serrors.StatusError
+	if !errors.As(err, &statusErr) {
+		err = httpUtils.UnexpectedError("Unable to reach the Kubernetes API", err)
+	}
+
+	if err := httpUtils.ErrorResponse(w, r, err); err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to write proxy error response")
+	}
+}
@@ -0,0 +1,245 @@
+package net
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/equinor/radix-common/models"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestToken(t *testing.T, claims jwt.MapClaims) string {
+	return newTestTokenWithKey(t, "any-key", claims)
+}
+
+func newTestTokenWithKey(t *testing.T, key string, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	require.NoError(t, err)
+	return token
+}
+
+func newFakeKubeAPI(t *testing.T, handler http.HandlerFunc) *url.URL {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return target
+}
+
+func Test_KubeAPIProxy_ForwardsUserCredentials(t *testing.T) {
+	var received *http.Request
+	target := newFakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		_, _ = w.Write([]byte("ok"))
+	})
+	sut := NewKubeAPIProxy(target, WithKubeAPIPathPrefix("/api/v1/k8s"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/k8s/api/v1/namespaces", nil)
+	req.Header.Set("Authorization", "Bearer other-token")
+	req.Header.Set("Impersonate-User", "other-user")
+	req.Header.Set("Impersonate-Extra-Scopes", "any")
+	impersonation, _ := models.NewImpersonation("any-user", []string{"group1", "group2"})
+	w := httptest.NewRecorder()
+	sut.Handle(models.NewAccounts("user-token", impersonation), w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, received)
+	assert.Equal(t, "/api/v1/namespaces", received.URL.Path)
+	assert.Equal(t, "Bearer user-token", received.Header.Get("Authorization"))
+	assert.Equal(t, "any-user", received.Header.Get("Impersonate-User"))
+	assert.Equal(t, []string{"group1", "group2"}, received.Header.Values("Impersonate-Group"))
+	assert.Empty(t, received.Header.Get("Impersonate-Extra-Scopes"))
+}
+
+func Test_KubeAPIProxy_PathPrefixSegments(t *testing.T) {
+	var received []string
+	target := newFakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.EscapedPath())
+	})
+	sut := NewKubeAPIProxy(target, WithKubeAPIPathPrefix("/api"))
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		sut.Handle(models.NewAccounts("user-token", models.Impersonation{}), w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/api/apis/apps/v1"))
+	assert.Equal(t, http.StatusOK, serve("/api"))
+	assert.Equal(t, http.StatusOK, serve("/api/api/v1/namespaces/any%2Fns"))
+	assert.Equal(t, http.StatusNotFound, serve("/apis/apps/v1"), "The prefix must end at a path segment boundary")
+	assert.Equal(t, http.StatusNotFound, serve("/apifoo"))
+	assert.Equal(t, http.StatusNotFound, serve("/other"))
+	assert.Equal(t, []string{"/apis/apps/v1", "/", "/api/v1/namespaces/any%2Fns"}, received)
+}
+
+func Test_KubeAPIProxy_ServiceCredentialsRequireServiceToken(t *testing.T) {
+	assert.Panics(t, func() { WithServiceCredentials(nil, nil) })
+}
+
+func Test_KubeAPIProxy_ServiceCredentialsImpersonatesCaller(t *testing.T) {
+	var received *http.Request
+	target := newFakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	})
+	serviceToken := func(context.Context) (string, error) { return "service-token", nil }
+	verifier := JWTCallerVerifier(func(*jwt.Token) (interface{}, error) { return []byte("any-key"), nil }, jwt.WithValidMethods([]string{"HS256"}))
+	sut := NewKubeAPIProxy(target, WithServiceCredentials(serviceToken, verifier))
+	userToken := newTestToken(t, jwt.MapClaims{"upn": "radix@equinor.com", "groups": []string{"group1", "group2"}})
+
+	w := httptest.NewRecorder()
+	sut.Handle(models.NewAccounts(userToken, models.Impersonation{}), w, httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, received)
+	assert.Equal(t, "Bearer service-token", received.Header.Get("Authorization"))
+	assert.Equal(t, "radix@equinor.com", received.Header.Get("Impersonate-User"))
+	assert.Equal(t, []string{"group1", "group2"}, received.Header.Values("Impersonate-Group"))
+
+	impersonation, _ := models.NewImpersonation("any-user", []string{"any-group"})
+	w = httptest.NewRecorder()
+	sut.Handle(models.NewAccounts(userToken, impersonation), w, httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func Test_KubeAPIProxy_ServiceCredentialsRejectsUnverifiedCaller(t *testing.T) {
+	called := false
+	target := newFakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	serviceToken := func(context.Context) (string, error) { return "service-token", nil }
+	verifier := JWTCallerVerifier(func(*jwt.Token) (interface{}, error) { return []byte("trusted-key"), nil }, jwt.WithValidMethods([]string{"HS256"}))
+	trustedToken := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("trusted-key"))
+		require.NoError(t, err)
+		return token
+	}
+
+	tests := map[string]struct {
+		verifier     KubeAPICallerVerifier
+		token        string
+		expectedCode int
+	}{
+		"forged token": {
+			verifier:     verifier,
+			token:        newTestToken(t, jwt.MapClaims{"upn": "radix@equinor.com", "groups": []string{"system:masters"}}),
+			expectedCode: http.StatusUnauthorized,
+		},
+		"missing upn": {
+			verifier:     verifier,
+			token:        trustedToken(jwt.MapClaims{"groups": []string{"group1"}}),
+			expectedCode: http.StatusUnauthorized,
+		},
+		"missing token": {
+			verifier:     verifier,
+			expectedCode: http.StatusUnauthorized,
+		},
+		"no verifier": {
+			token:        trustedToken(jwt.MapClaims{"upn": "radix@equinor.com"}),
+			expectedCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			sut := NewKubeAPIProxy(target, WithServiceCredentials(serviceToken, test.verifier))
+			w := httptest.NewRecorder()
+			sut.Handle(models.NewAccounts(test.token, models.Impersonation{}), w, httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil))
+			assert.Equal(t, test.expectedCode, w.Code)
+			assert.False(t, called)
+		})
+	}
+}
+
+func Test_KubeAPIProxy_RejectsUnauthenticatedCaller(t *testing.T) {
+	called := false
+	target := newFakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	sut := NewKubeAPIProxy(target)
+
+	w := httptest.NewRecorder()
+	sut.Handle(models.NewAccounts("", models.Impersonation{}), w, httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.False(t, called)
+}
+
+func Test_KubeAPIProxy_MapsStatusErrors(t *testing.T) {
+	target := newFakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		_ = json.NewEncoder(w).Encode(metav1.Status{
+			TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+			Status:   metav1.StatusFailure,
+			Message:  `pods is forbidden: User "any-user" cannot list resource "pods"`,
+			Reason:   metav1.StatusReasonForbidden,
+			Code:     http.StatusForbidden,
+		})
+	})
+	sut := NewKubeAPIProxy(target)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	sut.Handle(models.NewAccounts("user-token", models.Impersonation{}), w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	body, _ := io.ReadAll(w.Body)
+	assert.Contains(t, string(body), `cannot list resource`)
+}
+
+func Test_KubeAPIProxy_PassesThroughOtherErrors(t *testing.T) {
+	target := newFakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("upstream unavailable"))
+	})
+	sut := NewKubeAPIProxy(target)
+
+	w := httptest.NewRecorder()
+	sut.Handle(models.NewAccounts("user-token", models.Impersonation{}), w, httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "upstream unavailable", w.Body.String())
+}
+
+func Test_KubeAPIProxy_UnreachableUpstream(t *testing.T) {
+	target := newFakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {})
+	target.Host = "127.0.0.1:1"
+	sut := NewKubeAPIProxy(target)
+
+	w := httptest.NewRecorder()
+	sut.Handle(models.NewAccounts("user-token", models.Impersonation{}), w, httptest.NewRequest(http.MethodGet, "/api/v1/pods", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func Test_KubeAPIProxy_StreamsWatchResponses(t *testing.T) {
+	release := make(chan struct{})
+	target := newFakeKubeAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"type":"ADDED"}` + "\n"))
+		w.(http.Flusher).Flush()
+		<-release
+	})
+	sut := NewKubeAPIProxy(target)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sut.Handle(models.NewAccounts("user-token", models.Impersonation{}), w, r)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	resp, err := http.Get(server.URL + "/api/v1/pods?watch=true")
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	line := make([]byte, len(`{"type":"ADDED"}`))
+	_, err = io.ReadFull(resp.Body, line)
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"ADDED"}`, string(line))
+}
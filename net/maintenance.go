@@ -0,0 +1,115 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/equinor/radix-common/utils"
+	"github.com/equinor/radix-common/utils/timewindow"
+	"github.com/rs/zerolog"
+)
+
+// MaintenanceWindows Announces and enforces maintenance windows.
+// During a window, requests to mutating routes are answered with 503 Service Unavailable and Retry-After set
+// to the end of the window, while read-only requests are let through with a Warning header.
+// Requests with a safe method, e.g. GET, and requests to routes with models.Route ReadOnly set are read-only.
+// Ahead of a window, responses get a Warning header announcing the start of the window
+type MaintenanceWindows struct {
+	clock     utils.Clock
+	warnAhead time.Duration
+
+	mu      sync.RWMutex
+	windows []*timewindow.TimeWindow
+}
+
+// NewMaintenanceWindows Constructor for MaintenanceWindows. Warnings are sent warnAhead before the start of a window
+func NewMaintenanceWindows(clock utils.Clock, warnAhead time.Duration, windows ...*timewindow.TimeWindow) *MaintenanceWindows {
+	return &MaintenanceWindows{
+		clock:     clock,
+		warnAhead: warnAhead,
+		windows:   windows,
+	}
+}
+
+// SetWindows Replaces the maintenance windows, e.g. when the configuration is reloaded
+func (maintenance *MaintenanceWindows) SetWindows(windows ...*timewindow.TimeWindow) {
+	maintenance.mu.Lock()
+	defer maintenance.mu.Unlock()
+	maintenance.windows = windows
+}
+
+// Active Reports whether now is within a maintenance window, and the end of the latest ending window containing now
+func (maintenance *MaintenanceWindows) Active(now time.Time) (time.Time, bool) {
+	maintenance.mu.RLock()
+	defer maintenance.mu.RUnlock()
+
+	var end time.Time
+	for _, window := range maintenance.windows {
+		if windowEnd, ok := window.End(now); ok && windowEnd.After(end) {
+			end = windowEnd
+		}
+	}
+	return end, !end.IsZero()
+}
+
+// NextStart The start of the first maintenance window starting after now, or false when there are no windows
+func (maintenance *MaintenanceWindows) NextStart(now time.Time) (time.Time, bool) {
+	maintenance.mu.RLock()
+	defer maintenance.mu.RUnlock()
+
+	var next time.Time
+	for _, window := range maintenance.windows {
+		if start, ok := window.NextStart(now); ok && (next.IsZero() || start.Before(next)) {
+			next = start
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Middleware Enforces the maintenance windows for mutating requests, and warns about active and upcoming windows
+func (maintenance *MaintenanceWindows) Middleware() models.Middleware {
+	return func(next models.RadixHandlerFunc) models.RadixHandlerFunc {
+		return func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+			now := maintenance.clock.Now()
+
+			if end, ok := maintenance.Active(now); ok {
+				if !isReadOnlyRequest(r) {
+					w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(end.Sub(now)))))
+					err := httpUtils.ServiceUnavailableError(fmt.Sprintf("The service is under maintenance until %s", end.UTC().Format(time.RFC3339)))
+					if err := httpUtils.ErrorResponse(w, r, err); err != nil {
+						zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to write maintenance error response")
+					}
+					return
+				}
+				httpUtils.AddWarning(r.Context(), fmt.Sprintf("Maintenance in progress until %s, changes are not accepted", end.UTC().Format(time.RFC3339)))
+			} else if start, ok := maintenance.NextStart(now); ok && start.Sub(now) <= maintenance.warnAhead {
+				httpUtils.AddWarning(r.Context(), fmt.Sprintf("Maintenance starts at %s", start.UTC().Format(time.RFC3339)))
+			}
+
+			next(accounts, w, r)
+		}
+	}
+}
+
+type readOnlyRouteKey struct{}
+
+// withReadOnlyRoute Returns a copy of the request marked as a request to a read-only route, see WithReadOnly
+func withReadOnlyRoute(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), readOnlyRouteKey{}, true))
+}
+
+// isReadOnlyRequest Reports whether the request has a safe method, or is to a read-only route
+func isReadOnlyRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	readOnly, _ := r.Context().Value(readOnlyRouteKey{}).(bool)
+	return readOnly
+}
@@ -0,0 +1,63 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/equinor/radix-common/utils"
+	"github.com/equinor/radix-common/utils/timewindow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MaintenanceWindows(t *testing.T) {
+	window, err := timewindow.New([]string{"wed"}, "10:00", "11:59:59", "UTC")
+	require.NoError(t, err)
+	clock := utils.NewFakeClock(time.Date(2019, 4, 10, 9, 0, 0, 0, time.UTC))
+	maintenance := NewMaintenanceWindows(clock, 30*time.Minute, window)
+	handler := func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		_ = httpUtils.StringResponse(w, r, "ok")
+	}
+	sut := NewRouter(nil, WithMiddlewares(maintenance.Middleware())).AddRoutes(models.Routes{
+		{Path: "/jobs", Method: http.MethodGet, Authentication: models.AuthenticationAnonymous, HandlerFunc: handler},
+		{Path: "/jobs", Method: http.MethodPost, Authentication: models.AuthenticationAnonymous, HandlerFunc: handler},
+		{Path: "/jobs/search", Method: http.MethodPost, Authentication: models.AuthenticationAnonymous, ReadOnly: true, HandlerFunc: handler},
+	})
+	serveAt := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sut.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	serve := func(method string) *httptest.ResponseRecorder {
+		return serveAt(method, "/jobs")
+	}
+
+	w := serve(http.MethodPost)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Values("Warning"), "No warning long before the window")
+
+	clock.Advance(45 * time.Minute)
+	w = serve(http.MethodPost)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `299 - "Maintenance starts at 2019-04-10T10:00:00Z"`, w.Header().Get("Warning"))
+
+	clock.Advance(15 * time.Minute)
+	w = serve(http.MethodPost)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "7200", w.Header().Get("Retry-After"))
+	w = serve(http.MethodGet)
+	assert.Equal(t, http.StatusOK, w.Code, "Read-only routes are let through")
+	assert.Equal(t, `299 - "Maintenance in progress until 2019-04-10T12:00:00Z, changes are not accepted"`, w.Header().Get("Warning"))
+	w = serveAt(http.MethodPost, "/jobs/search")
+	assert.Equal(t, http.StatusOK, w.Code, "Routes marked read-only are let through")
+	assert.Equal(t, []string{`299 - "Maintenance in progress until 2019-04-10T12:00:00Z, changes are not accepted"`}, w.Header().Values("Warning"))
+
+	maintenance.SetWindows()
+	w = serve(http.MethodPost)
+	assert.Equal(t, http.StatusOK, w.Code, "Windows are reloaded at runtime")
+	assert.Empty(t, w.Header().Values("Warning"))
+}
@@ -0,0 +1,259 @@
+package net
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/rs/zerolog"
+)
+
+const (
+	unknownRouteLabel   = "unknown"
+	overflowRouteLabel  = "other"
+	otherLabel          = "other"
+	noErrorTypeLabel    = "none"
+	defaultMaxRoutes    = 500
+	metricsContentType  = "text/plain; version=0.0.4; charset=utf-8"
+	requestsTotalName   = "http_requests_total"
+	requestDurationName = "http_request_duration_seconds"
+	requestsInFlight    = "http_requests_in_flight"
+)
+
+// DefaultDurationBuckets Default buckets for the request duration histogram, in seconds
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var knownMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+
+var knownErrorTypes = []httpUtils.Type{httpUtils.Server, httpUtils.Missing, httpUtils.User, httpUtils.Forbidden, httpUtils.Unauthorized, httpUtils.TooManyRequests, httpUtils.Unavailable, httpUtils.Timeout, httpUtils.Conflict, httpUtils.Unprocessable}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type requestKey struct {
+	routeKey
+	statusClass string
+	errorType   string
+}
+
+type durationKey struct {
+	routeKey
+	statusClass string
+}
+
+func (k routeKey) sortKey() string {
+	return k.method + "\x00" + k.route
+}
+
+func (k requestKey) sortKey() string {
+	return k.routeKey.sortKey() + "\x00" + k.statusClass + "\x00" + k.errorType
+}
+
+func (k durationKey) sortKey() string {
+	return k.routeKey.sortKey() + "\x00" + k.statusClass
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Metrics Per-route request counters, request duration histograms and in-flight gauges for RadixMiddleware routes,
+// exposed in Prometheus text exposition format.
+// Routes are labelled with the route path template. The number of distinct routes is limited,
+// and routes beyond the limit are labelled "other"
+type Metrics struct {
+	mu        sync.Mutex
+	buckets   []float64
+	maxRoutes int
+	routes    map[string]struct{}
+	requests  map[requestKey]uint64
+	durations map[durationKey]*histogram
+	inFlight  map[routeKey]int64
+}
+
+// NewMetrics Constructor for Metrics with DefaultDurationBuckets
+func NewMetrics() *Metrics {
+	return NewMetricsWithBuckets(DefaultDurationBuckets, defaultMaxRoutes)
+}
+
+// NewMetricsWithBuckets Constructor for Metrics with custom duration buckets in seconds, and max number of distinct routes
+func NewMetricsWithBuckets(buckets []float64, maxRoutes int) *Metrics {
+	sortedBuckets := slices.Clone(buckets)
+	sort.Float64s(sortedBuckets)
+	return &Metrics{
+		buckets:   sortedBuckets,
+		maxRoutes: maxRoutes,
+		routes:    map[string]struct{}{},
+		requests:  map[requestKey]uint64{},
+		durations: map[durationKey]*histogram{},
+		inFlight:  map[routeKey]int64{},
+	}
+}
+
+// Begin Registers a request in flight for the route. The returned function must be called with the response recorder
+// when the request is handled, and whether the handler completed. A request without a response status is counted as
+// 200 OK when the handler completed, and as a server error when the handler panicked
+func (m *Metrics) Begin(method, route string) func(recorder *ResponseRecorder, completed bool) {
+	startTime := time.Now()
+
+	m.mu.Lock()
+	key := routeKey{method: methodLabel(method), route: m.routeLabel(route)}
+	m.inFlight[key]++
+	m.mu.Unlock()
+
+	return func(recorder *ResponseRecorder, completed bool) {
+		elapsed := time.Since(startTime).Seconds()
+		status, errorType := recorder.Status(), recorder.ErrorType()
+		if status == 0 {
+			status = http.StatusOK
+			if !completed {
+				status, errorType = http.StatusInternalServerError, httpUtils.Server
+			}
+		}
+		statusClass := fmt.Sprintf("%dxx", status/100)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.inFlight[key]--
+		m.requests[requestKey{routeKey: key, statusClass: statusClass, errorType: errorTypeLabel(errorType)}]++
+		m.observe(durationKey{routeKey: key, statusClass: statusClass}, elapsed)
+	}
+}
+
+// Handler Serves the metrics in Prometheus text exposition format
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", metricsContentType)
+		if err := m.Write(w); err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to write metrics")
+		}
+	})
+}
+
+// Write Writes the metrics in Prometheus text exposition format
+func (m *Metrics) Write(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("# HELP " + requestsTotalName + " Total number of HTTP requests.\n")
+	sb.WriteString("# TYPE " + requestsTotalName + " counter\n")
+	for _, key := range sortedKeys(m.requests) {
+		writeSample(&sb, requestsTotalName, formatLabels("method", key.method, "route", key.route, "status_class", key.statusClass, "error_type", key.errorType), strconv.FormatUint(m.requests[key], 10))
+	}
+
+	sb.WriteString("# HELP " + requestDurationName + " Duration of HTTP requests in seconds.\n")
+	sb.WriteString("# TYPE " + requestDurationName + " histogram\n")
+	for _, key := range sortedKeys(m.durations) {
+		h := m.durations[key]
+		labels := []string{"method", key.method, "route", key.route, "status_class", key.statusClass}
+		var cumulative uint64
+		for i, bucket := range m.buckets {
+			cumulative += h.counts[i]
+			writeSample(&sb, requestDurationName+"_bucket", formatLabels(append(labels, "le", strconv.FormatFloat(bucket, 'g', -1, 64))...), strconv.FormatUint(cumulative, 10))
+		}
+		writeSample(&sb, requestDurationName+"_bucket", formatLabels(append(labels, "le", "+Inf")...), strconv.FormatUint(h.count, 10))
+		writeSample(&sb, requestDurationName+"_sum", formatLabels(labels...), strconv.FormatFloat(h.sum, 'g', -1, 64))
+		writeSample(&sb, requestDurationName+"_count", formatLabels(labels...), strconv.FormatUint(h.count, 10))
+	}
+
+	sb.WriteString("# HELP " + requestsInFlight + " Number of HTTP requests in flight.\n")
+	sb.WriteString("# TYPE " + requestsInFlight + " gauge\n")
+	for _, key := range sortedKeys(m.inFlight) {
+		writeSample(&sb, requestsInFlight, formatLabels("method", key.method, "route", key.route), strconv.FormatInt(m.inFlight[key], 10))
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func (m *Metrics) observe(key durationKey, seconds float64) {
+	h, ok := m.durations[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		m.durations[key] = h
+	}
+	for i, bucket := range m.buckets {
+		if seconds <= bucket {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// routeLabel The route label value, limiting the number of distinct routes. Must be called with the lock held
+func (m *Metrics) routeLabel(route string) string {
+	if len(route) == 0 {
+		return unknownRouteLabel
+	}
+	if _, ok := m.routes[route]; ok {
+		return route
+	}
+	if len(m.routes) >= m.maxRoutes {
+		return overflowRouteLabel
+	}
+	m.routes[route] = struct{}{}
+	return route
+}
+
+func methodLabel(method string) string {
+	if slices.Contains(knownMethods, method) {
+		return method
+	}
+	return otherLabel
+}
+
+func errorTypeLabel(errorType httpUtils.Type) string {
+	switch {
+	case len(errorType) == 0:
+		return noErrorTypeLabel
+	case slices.Contains(knownErrorTypes, errorType):
+		return string(errorType)
+	default:
+		return otherLabel
+	}
+}
+
+func sortedKeys[K interface {
+	comparable
+	sortKey() string
+}, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].sortKey() < keys[j].sortKey() })
+	return keys
+}
+
+func writeSample(sb *strings.Builder, name, labels, value string) {
+	sb.WriteString(name)
+	sb.WriteString(labels)
+	sb.WriteString(" ")
+	sb.WriteString(value)
+	sb.WriteString("\n")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels Formats label name and value pairs
+func formatLabels(nameValues ...string) string {
+	pairs := make([]string, 0, len(nameValues)/2)
+	for i := 0; i+1 < len(nameValues); i += 2 {
+		pairs = append(pairs, nameValues[i]+`="`+labelValueEscaper.Replace(nameValues[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,109 @@
+package net
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeMetrics(t *testing.T, metrics *Metrics) string {
+	var sb strings.Builder
+	require.NoError(t, metrics.Write(&sb))
+	return sb.String()
+}
+
+func Test_Metrics_RadixMiddleware(t *testing.T) {
+	metrics := NewMetricsWithBuckets([]float64{1, 0.5}, 10)
+	handler := func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("appName") == "missing" {
+			_ = httpUtils.ErrorResponse(w, r, httpUtils.NotFoundError("not found"))
+			return
+		}
+		_ = httpUtils.StringResponse(w, r, "ok")
+	}
+	router := NewRouter(nil, WithMetrics(metrics)).AddRoutes(models.Routes{
+		{Path: "/applications/{appName}", Method: http.MethodGet, Authentication: models.AuthenticationAnonymous, HandlerFunc: handler},
+	})
+
+	for _, appName := range []string{"app1", "app2", "missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/applications/"+appName, nil))
+	}
+
+	out := writeMetrics(t, metrics)
+	assert.Contains(t, out, "# TYPE http_requests_total counter\n")
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/applications/{appName}",status_class="2xx",error_type="none"} 2`+"\n")
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/applications/{appName}",status_class="4xx",error_type="missing"} 1`+"\n")
+	assert.Contains(t, out, "# TYPE http_request_duration_seconds histogram\n")
+	assert.Contains(t, out, `http_request_duration_seconds_bucket{method="GET",route="/applications/{appName}",status_class="2xx",le="0.5"} 2`+"\n")
+	assert.Contains(t, out, `http_request_duration_seconds_bucket{method="GET",route="/applications/{appName}",status_class="2xx",le="1"} 2`+"\n")
+	assert.Contains(t, out, `http_request_duration_seconds_bucket{method="GET",route="/applications/{appName}",status_class="2xx",le="+Inf"} 2`+"\n")
+	assert.Contains(t, out, `http_request_duration_seconds_count{method="GET",route="/applications/{appName}",status_class="2xx"} 2`+"\n")
+	assert.Contains(t, out, `http_requests_in_flight{method="GET",route="/applications/{appName}"} 0`+"\n")
+	assert.NotContains(t, out, "app1", "Routes are labelled with the path template")
+}
+
+func Test_Metrics_InFlight(t *testing.T) {
+	metrics := NewMetrics()
+	done := metrics.Begin(http.MethodPost, "/any")
+	assert.Contains(t, writeMetrics(t, metrics), `http_requests_in_flight{method="POST",route="/any"} 1`+"\n")
+
+	recorder := NewResponseRecorder(httptest.NewRecorder())
+	recorder.WriteHeader(http.StatusAccepted)
+	done(recorder, true)
+
+	out := writeMetrics(t, metrics)
+	assert.Contains(t, out, `http_requests_in_flight{method="POST",route="/any"} 0`+"\n")
+	assert.Contains(t, out, `http_requests_total{method="POST",route="/any",status_class="2xx",error_type="none"} 1`+"\n")
+}
+
+func Test_Metrics_LimitsLabelCardinality(t *testing.T) {
+	metrics := NewMetricsWithBuckets(DefaultDurationBuckets, 1)
+	for _, route := range []string{"/first", "/second", ""} {
+		metrics.Begin("BREW", route)(NewResponseRecorder(httptest.NewRecorder()), true)
+	}
+
+	out := writeMetrics(t, metrics)
+	assert.Contains(t, out, `http_requests_total{method="other",route="/first",status_class="2xx",error_type="none"} 1`+"\n")
+	assert.Contains(t, out, `http_requests_total{method="other",route="other",status_class="2xx",error_type="none"} 1`+"\n")
+	assert.Contains(t, out, `http_requests_total{method="other",route="unknown",status_class="2xx",error_type="none"} 1`+"\n")
+	assert.NotContains(t, out, "/second")
+}
+
+func Test_Metrics_ErrorTypeThroughTimeout(t *testing.T) {
+	metrics := NewMetrics()
+	handler := func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		_ = httpUtils.ErrorResponse(w, r, httpUtils.UnexpectedError("any error", errors.New("any cause")))
+	}
+	NewRadixMiddlewareForRoute(models.Route{Path: "/any", Authentication: models.AuthenticationAnonymous, HandlerFunc: handler}, nil, WithMetrics(metrics), WithTimeout(time.Second)).
+		Handle(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/any", nil))
+
+	assert.Contains(t, writeMetrics(t, metrics), `http_requests_total{method="GET",route="/any",status_class="5xx",error_type="server"} 1`+"\n")
+}
+
+func Test_Metrics_PanicWithoutRecovery(t *testing.T) {
+	metrics := NewMetrics()
+	handler := func(models.Accounts, http.ResponseWriter, *http.Request) { panic("any panic") }
+	sut := NewRadixMiddlewareForRoute(models.Route{Path: "/any", Authentication: models.AuthenticationAnonymous, HandlerFunc: handler}, nil, WithMetrics(metrics))
+	assert.Panics(t, func() { sut.Handle(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/any", nil)) })
+
+	out := writeMetrics(t, metrics)
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/any",status_class="5xx",error_type="server"} 1`+"\n")
+	assert.NotContains(t, out, `status_class="2xx"`)
+}
+
+func Test_Metrics_Handler(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewMetrics().Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "# HELP http_requests_in_flight ")
+}
@@ -0,0 +1,464 @@
+package net
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elnormous/contenttype"
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	openAPIVersion      = "3.1.0"
+	errorSchemaName     = "Error"
+	bearerSchemeName    = "bearer"
+	jsonMediaType       = "application/json"
+	yamlMediaType       = "application/yaml"
+	componentsSchemaRef = "#/components/schemas/"
+)
+
+var (
+	openAPIMediaTypes = []contenttype.MediaType{
+		contenttype.NewMediaType(jsonMediaType),
+		contenttype.NewMediaType(yamlMediaType),
+	}
+	invalidSchemaNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+	timeType               = reflect.TypeOf(time.Time{})
+	durationType           = reflect.TypeOf(time.Duration(0))
+	rawMessageType         = reflect.TypeOf(json.RawMessage{})
+	apiErrorType           = reflect.TypeOf(httpUtils.Error{})
+	jsonMarshalerType      = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType      = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// OpenAPIInfo Title, version and description of the API
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIDocument OpenAPI 3.1 document
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIComponents Reusable schemas and security schemes
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// OpenAPISecurityScheme Security scheme of authenticated operations
+type OpenAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+}
+
+// OpenAPIOperation Operation on a path
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+}
+
+// OpenAPIParameter Path, query or header parameter of an operation
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIRequestBody Request body of an operation
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse Response of an operation
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType Schema of a request or response body
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema JSON schema of a type
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+}
+
+// NewOpenAPIDocument Generates an OpenAPI document for the routes, describing the types in RouteDocs by reflection.
+// Routes without a method are not included. Errors are described by the Error schema of net/http.Error,
+// and routes requiring authentication also document the unauthorized error
+func NewOpenAPIDocument(info OpenAPIInfo, routes models.Routes) *OpenAPIDocument {
+	generator := &schemaGenerator{schemas: map[string]*OpenAPISchema{}, names: map[reflect.Type]string{}}
+	doc := &OpenAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    info,
+		Paths:   map[string]map[string]*OpenAPIOperation{},
+	}
+
+	for _, route := range routes {
+		if len(route.Method) == 0 {
+			continue
+		}
+		path, pathParams := openAPIPath(route.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*OpenAPIOperation{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = generator.operation(route, pathParams)
+	}
+
+	doc.Components.Schemas = generator.schemas
+	doc.Components.SecuritySchemes = map[string]OpenAPISecurityScheme{
+		bearerSchemeName: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+	}
+	return doc
+}
+
+// JSON The document as JSON
+func (doc *OpenAPIDocument) JSON() ([]byte, error) {
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// YAML The document as YAML
+func (doc *OpenAPIDocument) YAML() ([]byte, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML. Decoding it to a node keeps the order of the fields
+	var node yaml.Node
+	if err = yaml.Unmarshal(body, &node); err != nil {
+		return nil, err
+	}
+	resetYAMLStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// Handler Serves the document as JSON, or as YAML when requested in the Accept header
+func (doc *OpenAPIDocument) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType := jsonMediaType
+		if len(r.Header.Get("Accept")) > 0 {
+			if acceptable, _, err := contenttype.GetAcceptableMediaType(r, openAPIMediaTypes); err == nil {
+				mediaType = acceptable.MIME()
+			}
+		}
+
+		render := doc.JSON
+		if mediaType == yamlMediaType {
+			render = doc.YAML
+		}
+		body, err := render()
+		if err != nil {
+			if err = httpUtils.ErrorResponseForServer(w, r, err); err != nil {
+				zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to write error response")
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", mediaType+"; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		if _, err = w.Write(body); err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to write OpenAPI document")
+		}
+	})
+}
+
+type schemaGenerator struct {
+	schemas map[string]*OpenAPISchema
+	names   map[reflect.Type]string
+}
+
+func (g *schemaGenerator) operation(route models.Route, pathParams []string) *OpenAPIOperation {
+	docs := route.Docs
+	if docs == nil {
+		docs = &models.RouteDocs{}
+	}
+	op := &OpenAPIOperation{
+		OperationID: docs.OperationID,
+		Summary:     docs.Summary,
+		Description: docs.Description,
+		Tags:        docs.Tags,
+		Responses:   map[string]*OpenAPIResponse{},
+		Deprecated:  route.Deprecation != nil,
+	}
+
+	for _, name := range pathParams {
+		param := OpenAPIParameter{Name: name, In: "path", Required: true, Schema: &OpenAPISchema{Type: "string"}}
+		if i := slices.IndexFunc(docs.Parameters, func(p models.ParameterDoc) bool {
+			return p.Name == name && (len(p.In) == 0 || p.In == "path")
+		}); i >= 0 {
+			param.Description = docs.Parameters[i].Description
+			param.Schema = g.parameterSchema(docs.Parameters[i].Type)
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+	for _, p := range docs.Parameters {
+		in := p.In
+		if len(in) == 0 {
+			if slices.Contains(pathParams, p.Name) {
+				continue
+			}
+			in = "query"
+		}
+		if in == "path" {
+			continue
+		}
+		op.Parameters = append(op.Parameters, OpenAPIParameter{Name: p.Name, In: in, Description: p.Description, Required: p.Required, Schema: g.parameterSchema(p.Type)})
+	}
+
+	if docs.Request != nil {
+		op.RequestBody = &OpenAPIRequestBody{Required: true, Content: g.content(reflect.TypeOf(docs.Request))}
+	}
+
+	status := docs.ResponseStatus
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := &OpenAPIResponse{Description: http.StatusText(status)}
+	if docs.Response != nil {
+		response.Content = g.content(reflect.TypeOf(docs.Response))
+	}
+	op.Responses[strconv.Itoa(status)] = response
+
+	errorTypes := slices.Clone(docs.ErrorTypes)
+	switch route.Authentication {
+	case models.AuthenticationRequired:
+		op.Security = []map[string][]string{{bearerSchemeName: {}}}
+		errorTypes = append(errorTypes, string(httpUtils.Unauthorized))
+	case models.AuthenticationOptional:
+		op.Security = []map[string][]string{{bearerSchemeName: {}}, {}}
+		errorTypes = append(errorTypes, string(httpUtils.Unauthorized))
+	}
+	for _, errType := range errorTypes {
+		code := strconv.Itoa(httpUtils.StatusCode(httpUtils.Type(errType)))
+		if _, ok := op.Responses[code]; ok {
+			continue
+		}
+		op.Responses[code] = &OpenAPIResponse{
+			Description: http.StatusText(httpUtils.StatusCode(httpUtils.Type(errType))),
+			Content:     map[string]OpenAPIMediaType{jsonMediaType: {Schema: g.schema(apiErrorType)}},
+		}
+	}
+	return op
+}
+
+func (g *schemaGenerator) content(t reflect.Type) map[string]OpenAPIMediaType {
+	if t.Kind() == reflect.String {
+		return map[string]OpenAPIMediaType{"text/plain": {Schema: &OpenAPISchema{Type: "string"}}}
+	}
+	return map[string]OpenAPIMediaType{jsonMediaType: {Schema: g.schema(t)}}
+}
+
+func (g *schemaGenerator) parameterSchema(value any) *OpenAPISchema {
+	if value == nil {
+		return &OpenAPISchema{Type: "string"}
+	}
+	return g.schema(reflect.TypeOf(value))
+}
+
+// schema JSON schema of the type. Named struct types are added to the components, and referenced
+func (g *schemaGenerator) schema(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case rawMessageType:
+		return &OpenAPISchema{}
+	case apiErrorType:
+		return g.ref(t, errorSchemaName, func() *OpenAPISchema {
+			types := make([]string, 0, len(knownErrorTypes))
+			for _, errType := range knownErrorTypes {
+				types = append(types, string(errType))
+			}
+			return &OpenAPISchema{
+				Type: "object",
+				Properties: map[string]*OpenAPISchema{
+					"type":    {Type: "string", Enum: types},
+					"message": {Type: "string"},
+					"error":   {Type: "string"},
+				},
+				Required: []string{"type", "message"},
+			}
+		})
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		return &OpenAPISchema{}
+	}
+	if t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return &OpenAPISchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &OpenAPISchema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &OpenAPISchema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return g.structSchema(t)
+		}
+		return g.ref(t, t.Name(), func() *OpenAPISchema { return g.structSchema(t) })
+	default:
+		return &OpenAPISchema{}
+	}
+}
+
+// ref Reference to the component schema of the named type, adding the schema when not already added.
+// Types with the same name in different packages are qualified with the package name
+func (g *schemaGenerator) ref(t reflect.Type, name string, build func() *OpenAPISchema) *OpenAPISchema {
+	if existing, ok := g.names[t]; ok {
+		return &OpenAPISchema{Ref: componentsSchemaRef + existing}
+	}
+
+	name = invalidSchemaNameChars.ReplaceAllString(name, "_")
+	if _, taken := g.schemas[name]; taken {
+		pkg := t.PkgPath()
+		qualified := invalidSchemaNameChars.ReplaceAllString(pkg[strings.LastIndex(pkg, "/")+1:], "_") + "." + name
+		name = qualified
+		for i := 2; taken; i++ {
+			if _, taken = g.schemas[name]; taken {
+				name = qualified + strconv.Itoa(i)
+			}
+		}
+	}
+
+	// Register the name before building the schema, so recursive types reference it
+	g.names[t] = name
+	g.schemas[name] = nil
+	g.schemas[name] = build()
+	return &OpenAPISchema{Ref: componentsSchemaRef + name}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	g.addFields(schema, t)
+	return schema
+}
+
+// addFields Adds the exported fields of the struct type to the schema, following the field names of encoding/json
+func (g *schemaGenerator) addFields(schema *OpenAPISchema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		flags := strings.Split(opts, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && len(name) == 0 && fieldType.Kind() == reflect.Struct {
+			g.addFields(schema, fieldType)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		fieldSchema := g.schema(field.Type)
+		if slices.Contains(flags, "string") && fieldSchema.Type != "string" && len(fieldSchema.Ref) == 0 {
+			fieldSchema = &OpenAPISchema{Type: "string"}
+		}
+		schema.Properties[name] = fieldSchema
+		if !slices.Contains(flags, "omitempty") && !slices.Contains(flags, "omitzero") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// openAPIPath Converts a http.ServeMux pattern path to an OpenAPI path, and returns the names of the path parameters
+func openAPIPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+		if name == "$" {
+			segments[i] = ""
+			continue
+		}
+		name = strings.TrimSuffix(name, "...")
+		segments[i] = "{" + name + "}"
+		params = append(params, name)
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func resetYAMLStyle(node *yaml.Node) {
+	if node.Kind != yaml.ScalarNode || node.Tag != "!!str" {
+		node.Style = 0
+	} else if node.Style == yaml.DoubleQuotedStyle {
+		// Keep strings that would otherwise be read as another type quoted
+		node.Style = 0
+		if out, err := yaml.Marshal(node.Value); err == nil && strings.TrimSpace(string(out)) != node.Value {
+			node.Style = yaml.DoubleQuotedStyle
+		}
+	}
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
@@ -0,0 +1,143 @@
+package net
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+type openAPITestComponent struct {
+	Name     string                 `json:"name"`
+	Replicas *int                   `json:"replicas,omitempty"`
+	Children []openAPITestComponent `json:"children,omitempty"`
+}
+
+type openAPITestApplication struct {
+	Name       string                 `json:"name"`
+	Owner      string                 `json:"owner,omitempty"`
+	Created    time.Time              `json:"created"`
+	Labels     map[string]string      `json:"labels,omitempty"`
+	Components []openAPITestComponent `json:"components"`
+	Internal   string                 `json:"-"`
+	internal   string
+}
+
+func openAPITestRoutes() models.Routes {
+	return models.Routes{
+		{
+			Path:   "/applications/{appName}",
+			Method: http.MethodGet,
+			Docs: &models.RouteDocs{
+				OperationID: "getApplication",
+				Summary:     "Get application",
+				Tags:        []string{"application"},
+				Parameters: []models.ParameterDoc{
+					{Name: "appName", Description: "Name of the application"},
+					{Name: "verbose", Type: true},
+				},
+				Response:   openAPITestApplication{},
+				ErrorTypes: []string{httpUtils.Missing, httpUtils.Forbidden},
+			},
+		},
+		{
+			Path:   "/applications",
+			Method: http.MethodPost,
+			Docs: &models.RouteDocs{
+				Request:        openAPITestApplication{},
+				Response:       &openAPITestApplication{},
+				ResponseStatus: http.StatusCreated,
+				ErrorTypes:     []string{httpUtils.User},
+			},
+		},
+		{Path: "/files/{path...}", Method: http.MethodGet, Authentication: models.AuthenticationAnonymous},
+		{Path: "/any"},
+	}
+}
+
+func Test_NewOpenAPIDocument_Operations(t *testing.T) {
+	doc := NewOpenAPIDocument(OpenAPIInfo{Title: "any", Version: "1.0"}, openAPITestRoutes())
+
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+	assert.NotContains(t, doc.Paths, "/any", "Routes without a method are not documented")
+	require.Contains(t, doc.Paths, "/files/{path}")
+	assert.Equal(t, "path", doc.Paths["/files/{path}"]["get"].Parameters[0].Name)
+	assert.Empty(t, doc.Paths["/files/{path}"]["get"].Security)
+	assert.NotContains(t, doc.Paths["/files/{path}"]["get"].Responses, "401")
+
+	get := doc.Paths["/applications/{appName}"]["get"]
+	require.NotNil(t, get)
+	assert.Equal(t, "getApplication", get.OperationID)
+	assert.Equal(t, []string{"application"}, get.Tags)
+	assert.Equal(t, []OpenAPIParameter{
+		{Name: "appName", In: "path", Description: "Name of the application", Required: true, Schema: &OpenAPISchema{Type: "string"}},
+		{Name: "verbose", In: "query", Schema: &OpenAPISchema{Type: "boolean"}},
+	}, get.Parameters)
+	assert.Equal(t, []map[string][]string{{"bearer": {}}}, get.Security)
+	assert.Equal(t, "#/components/schemas/openAPITestApplication", get.Responses["200"].Content["application/json"].Schema.Ref)
+	for _, code := range []string{"401", "403", "404"} {
+		require.Contains(t, get.Responses, code)
+		assert.Equal(t, "#/components/schemas/Error", get.Responses[code].Content["application/json"].Schema.Ref)
+	}
+
+	post := doc.Paths["/applications"]["post"]
+	require.NotNil(t, post)
+	assert.Equal(t, "#/components/schemas/openAPITestApplication", post.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Contains(t, post.Responses, "201")
+	assert.Contains(t, post.Responses, "400")
+}
+
+func Test_NewOpenAPIDocument_Schemas(t *testing.T) {
+	doc := NewOpenAPIDocument(OpenAPIInfo{Title: "any", Version: "1.0"}, openAPITestRoutes())
+
+	app := doc.Components.Schemas["openAPITestApplication"]
+	require.NotNil(t, app)
+	assert.Equal(t, "object", app.Type)
+	assert.ElementsMatch(t, []string{"name", "created", "components"}, app.Required)
+	assert.Equal(t, &OpenAPISchema{Type: "string", Format: "date-time"}, app.Properties["created"])
+	assert.Equal(t, &OpenAPISchema{Type: "object", AdditionalProperties: &OpenAPISchema{Type: "string"}}, app.Properties["labels"])
+	assert.Equal(t, &OpenAPISchema{Type: "array", Items: &OpenAPISchema{Ref: "#/components/schemas/openAPITestComponent"}}, app.Properties["components"])
+	assert.NotContains(t, app.Properties, "Internal")
+	assert.NotContains(t, app.Properties, "internal")
+
+	component := doc.Components.Schemas["openAPITestComponent"]
+	require.NotNil(t, component)
+	assert.Equal(t, []string{"name"}, component.Required)
+	assert.Equal(t, &OpenAPISchema{Type: "integer", Format: "int64"}, component.Properties["replicas"])
+	assert.Equal(t, "#/components/schemas/openAPITestComponent", component.Properties["children"].Items.Ref, "Recursive types are referenced")
+
+	errorSchema := doc.Components.Schemas["Error"]
+	require.NotNil(t, errorSchema)
+	assert.Equal(t, []string{"type", "message"}, errorSchema.Required)
+	assert.Contains(t, errorSchema.Properties["type"].Enum, "missing")
+}
+
+func Test_OpenAPIDocument_Handler(t *testing.T) {
+	handler := NewOpenAPIDocument(OpenAPIInfo{Title: "any", Version: "1.0"}, openAPITestRoutes()).Handler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var fromJSON map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fromJSON))
+	assert.Equal(t, "3.1.0", fromJSON["openapi"])
+
+	req := httptest.NewRequest(http.MethodGet, "/openapi", nil)
+	req.Header.Set("Accept", "application/yaml")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/yaml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "openapi: 3.1.0\n")
+	var fromYAML map[string]any
+	require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &fromYAML))
+	assert.Equal(t, fromJSON, fromYAML, "YAML and JSON documents are equal")
+}
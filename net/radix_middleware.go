@@ -1,38 +1,320 @@
 package net
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/equinor/radix-common/models"
 	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/equinor/radix-common/utils"
+	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/rs/zerolog"
 )
 
 // RadixMiddleware The middleware between router and radix handler functions
 type RadixMiddleware struct {
-	Path    string
-	Method  string
-	next    models.RadixHandlerFunc
-	handled func(*RadixMiddleware, http.ResponseWriter, *http.Request, time.Time)
+	Path            string
+	Method          string
+	next            models.RadixHandlerFunc
+	handlerFunc     models.RadixHandlerFunc
+	handled         func(*RadixMiddleware, http.ResponseWriter, *http.Request, time.Time)
+	authentication  models.AuthenticationMode
+	tokenValidation *tokenValidation
+	tokenVerifier   models.TokenVerifier
+	clientIP        *ClientIPResolver
+	cors            *CORSPolicy
+	noDefaultCORS   bool
+	recovery        bool
+	authorizers     []models.Authorizer
+	rateLimiter     *RateLimiter
+	rateLimit       *models.RateLimit
+	concurrency     *ConcurrencyLimiter
+	pools           map[string]*ConcurrencyLimiter
+	streaming       bool
+	readOnly        bool
+	pool            string
+	timeout         time.Duration
+	routeTimeout    time.Duration
+	traceContext    bool
+	metrics         *Metrics
+	middlewares     models.MiddlewareChain
+	deprecation     *models.Deprecation
+	certificates    *ClientCertificateAuthenticator
+	urlSigner       *URLSigner
+	signedURL       bool
+}
+
+// RadixMiddlewareOption Option for the radix middleware
+type RadixMiddlewareOption func(*RadixMiddleware)
+
+type tokenValidation struct {
+	clock  utils.Clock
+	leeway time.Duration
+}
+
+// WithTokenLifetimeValidation Rejects expired and not yet valid bearer tokens with 401 Unauthorized,
+// allowing leeway for clock skew between the issuer and this service
+func WithTokenLifetimeValidation(clock utils.Clock, leeway time.Duration) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.tokenValidation = &tokenValidation{clock: clock, leeway: leeway}
+	}
+}
+
+// WithClientCertificateAuthenticator Authenticates callers presenting a TLS client certificate with the authenticator,
+// as an alternative to bearer tokens. A client certificate takes precedence over a bearer token,
+// and invalid certificates are answered with 401 Unauthorized
+func WithClientCertificateAuthenticator(authenticator *ClientCertificateAuthenticator) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.certificates = authenticator
+	}
+}
+
+// WithURLSigner Sets the signer verifying signed URLs, for routes accepting signed URLs
+func WithURLSigner(signer *URLSigner) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.urlSigner = signer
+	}
+}
+
+// WithSignedURL Accepts URLs signed by the URL signer as authentication, instead of a bearer token.
+// Invalid and expired signatures are answered with 401 Unauthorized
+func WithSignedURL(signedURL bool) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.signedURL = signedURL
+	}
+}
+
+// WithTokenVerifier Verifies the signature of bearer tokens, e.g. with models.JWTTokenVerifier, and rejects invalid tokens
+// with 401 Unauthorized. The verified claims are used by models.RequireGroups and models.RequireAppRoles,
+// which deny all callers without a token verifier
+func WithTokenVerifier(verifier models.TokenVerifier) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.tokenVerifier = verifier
+	}
+}
+
+// WithClientIPResolver Resolves the client IP from the headers of trusted proxies, used to rate limit anonymous requests.
+// Without a resolver, the remote address of the connection is used
+func WithClientIPResolver(resolver *ClientIPResolver) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.clientIP = resolver
+	}
+}
+
+// WithAuthenticationMode Sets how requests are authenticated. Defaults to models.AuthenticationRequired
+func WithAuthenticationMode(mode models.AuthenticationMode) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.authentication = mode
+	}
+}
+
+// WithCORSPolicy Applies the CORS policy to requests, and answers preflight requests.
+// Without a policy, Access-Control-Allow-Origin: * is set on all responses
+func WithCORSPolicy(policy *CORSPolicy) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.cors = policy
+	}
+}
+
+// WithoutDefaultCORSHeader Does not set Access-Control-Allow-Origin: * on responses when there is no CORS policy,
+// e.g. when CORS is handled by the router
+func WithoutDefaultCORSHeader() RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.noDefaultCORS = true
+	}
+}
+
+// WithPanicRecovery Recovers panics in the handler, see HandlePanic
+func WithPanicRecovery() RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.recovery = true
+	}
+}
+
+// WithAuthorizers Adds authorizers that must all allow the request, e.g. a SubjectAccessReview check.
+// Requests are denied with 403 Forbidden
+func WithAuthorizers(authorizers ...models.Authorizer) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.authorizers = append(handler.authorizers, authorizers...)
+	}
+}
+
+// WithRateLimiter Limits the request rate per principal, or per client IP for anonymous requests.
+// Requests exceeding the limit are answered with 429 Too Many Requests
+func WithRateLimiter(limiter *RateLimiter) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.rateLimiter = limiter
+	}
+}
+
+// WithRateLimit Sets a rate limit for this route, replacing the default rate limit of the rate limiter.
+// Panics when the limit is not valid, see ValidateRateLimit
+func WithRateLimit(limit *models.RateLimit) RadixMiddlewareOption {
+	if limit != nil {
+		if err := ValidateRateLimit(*limit); err != nil {
+			panic(fmt.Sprintf("rate limit: %v", err))
+		}
+	}
+	return func(handler *RadixMiddleware) {
+		handler.rateLimit = limit
+	}
+}
+
+// WithConcurrencyLimiter Limits the number of requests in flight, except for streaming routes and routes in other pools
+func WithConcurrencyLimiter(limiter *ConcurrencyLimiter) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.concurrency = limiter
+	}
+}
+
+// WithConcurrencyPool Adds a named concurrency limiter pool, used by routes with a matching ConcurrencyPool
+func WithConcurrencyPool(name string, limiter *ConcurrencyLimiter) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		if handler.pools == nil {
+			handler.pools = map[string]*ConcurrencyLimiter{}
+		}
+		handler.pools[name] = limiter
+	}
+}
+
+// WithStreaming Marks the route as long-lived, e.g. server-sent events or log follow
+func WithStreaming(streaming bool) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.streaming = streaming
+	}
+}
+
+// WithReadOnly Marks the route as not changing state although the method is not safe, e.g. a search with POST
+func WithReadOnly(readOnly bool) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.readOnly = readOnly
+	}
+}
+
+// WithConcurrencyPoolName Counts the route in the named concurrency limiter pool instead of the default pool
+func WithConcurrencyPoolName(name string) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.pool = name
+	}
+}
+
+// WithTimeout Sets a default deadline for handlers. Handlers that overrun the deadline are answered with 504 Gateway Timeout.
+// Streaming routes are not limited by the default timeout
+func WithTimeout(timeout time.Duration) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.timeout = timeout
+	}
+}
+
+// WithRouteTimeout Sets the deadline for the route, replacing the default timeout. A negative timeout disables the timeout
+func WithRouteTimeout(timeout time.Duration) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.routeTimeout = timeout
+	}
+}
+
+// WithTraceContext Starts a W3C trace context for each request, and adds trace_id, span_id and request_id
+// to the zerolog logger in the request context, see StartTraceContext
+func WithTraceContext() RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.traceContext = true
+	}
+}
+
+// WithMetrics Records request count, duration and requests in flight for the route
+func WithMetrics(metrics *Metrics) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.metrics = metrics
+	}
+}
+
+// WithMiddlewares Wraps the handler in the middlewares, after the request is authenticated and authorized.
+// Middlewares are added after those of earlier options, and the middlewares of a route are added last.
+// Middlewares run outside the handler timeout, so they record the 504 Gateway Timeout answered when the handler overruns
+func WithMiddlewares(middlewares ...models.Middleware) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.middlewares = handler.middlewares.Append(middlewares...)
+	}
+}
+
+// WithDeprecation Marks the route as deprecated. Responses get Deprecation, Sunset, Link and Warning headers
+func WithDeprecation(deprecation *models.Deprecation) RadixMiddlewareOption {
+	return func(handler *RadixMiddleware) {
+		handler.deprecation = deprecation
+	}
 }
 
 // NewRadixMiddleware Constructor for radix middleware
-func NewRadixMiddleware(path, method string, next models.RadixHandlerFunc, handled func(*RadixMiddleware, http.ResponseWriter, *http.Request, time.Time)) *RadixMiddleware {
+func NewRadixMiddleware(path, method string, next models.RadixHandlerFunc, handled func(*RadixMiddleware, http.ResponseWriter, *http.Request, time.Time), options ...RadixMiddlewareOption) *RadixMiddleware {
 	handler := &RadixMiddleware{
 		Path:    path,
 		Method:  method,
 		next:    next,
 		handled: handled,
 	}
+	for _, option := range options {
+		option(handler)
+	}
+	if next != nil {
+		handler.handlerFunc = next
+		handler.next = handler.middlewares.Then(next)
+	}
 	return handler
 }
 
-// Handle Wraps radix handler methods
+// NewRadixMiddlewareForRoute Constructor for radix middleware, configured by the route.
+// Settings declared on the route take precedence over the options
+func NewRadixMiddlewareForRoute(route models.Route, handled func(*RadixMiddleware, http.ResponseWriter, *http.Request, time.Time), options ...RadixMiddlewareOption) *RadixMiddleware {
+	routeOptions := []RadixMiddlewareOption{
+		WithAuthenticationMode(route.Authentication),
+		WithAuthorizers(route.Authorization...),
+		WithStreaming(route.Streaming),
+		WithReadOnly(route.ReadOnly),
+		WithSignedURL(route.SignedURL),
+		WithConcurrencyPoolName(route.ConcurrencyPool),
+		WithRouteTimeout(route.Timeout),
+		WithMiddlewares(route.Middlewares...),
+	}
+	if route.RateLimit != nil {
+		routeOptions = append(routeOptions, WithRateLimit(route.RateLimit))
+	}
+	if route.Deprecation != nil {
+		routeOptions = append(routeOptions, WithDeprecation(route.Deprecation))
+	}
+	return NewRadixMiddleware(route.Path, route.Method, route.HandlerFunc, handled, append(options, routeOptions...)...)
+}
+
+// Handle Wraps radix handler methods.
+// The response writer is wrapped in a ResponseRecorder, which is passed to the handled callback
 func (handler *RadixMiddleware) Handle(w http.ResponseWriter, r *http.Request) {
 	startTime := time.Now()
+	recorder := NewResponseRecorder(w)
+	// The request is counted when the handler panics, before the panic is recovered
+	completed := false
+	if handler.metrics != nil {
+		done := handler.metrics.Begin(r.Method, handler.Path)
+		defer func() { done(recorder, completed) }()
+	}
+	handler.handle(recorder, r, startTime)
+	completed = true
+}
+
+func (handler *RadixMiddleware) handle(recorder *ResponseRecorder, r *http.Request, startTime time.Time) {
+	var w http.ResponseWriter = recorder
+	if handler.traceContext {
+		r = StartTraceContext(w, r)
+	}
+	r = r.WithContext(httpUtils.ContextWithWarnings(r.Context()))
+	recorder.setWarningsRequest(r)
+	if handler.clientIP != nil {
+		r = withClientIP(r, handler.clientIP.ClientIP(r))
+	}
+	if handler.readOnly {
+		r = withReadOnlyRoute(r)
+	}
 	logger := zerolog.Ctx(r.Context())
-	w.Header().Add("Access-Control-Allow-Origin", "*")
 
 	defer func() {
 		if handler.handled != nil {
@@ -40,23 +322,238 @@ func (handler *RadixMiddleware) Handle(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	token, err := httpUtils.GetBearerTokenFromHeader(r)
+	if handler.recovery {
+		defer RecoverPanic(w, r)
+	}
+
+	if handler.deprecation != nil {
+		handler.writeDeprecationHeaders(r.Context(), w.Header())
+	}
+
+	if handler.cors == nil {
+		if !handler.noDefaultCORS {
+			w.Header().Add("Access-Control-Allow-Origin", "*")
+		}
+	} else if handler.cors.Apply(w, r) {
+		return
+	}
+
+	accounts, err := handler.authenticate(r)
 	if err != nil {
-		if err := httpUtils.ErrorResponse(w, r, err); err != nil {
+		if err := authenticationErrorResponse(w, r, err); err != nil {
 			logger.Error().Err(err).Msg("unable to write auth error response")
 		}
+		return
+	}
+
+	if err := handler.limitRate(w, r, accounts); err != nil {
+		if err := httpUtils.ErrorResponse(w, r, err); err != nil {
+			logger.Error().Err(err).Msg("unable to write rate limit error response")
+		}
+		return
+	}
+
+	release := func() {}
+	if limiter := handler.concurrencyLimiter(); limiter != nil {
+		var err error
+		if release, err = limiter.Enter(w, r); err != nil {
+			if err := httpUtils.ErrorResponse(w, r, err); err != nil {
+				logger.Error().Err(err).Msg("unable to write concurrency limit error response")
+			}
+			return
+		}
+	}
+	defer func() { release() }()
+
+	if err := handler.authorize(r, accounts); err != nil {
+		if err := httpUtils.ErrorResponse(w, r, err); err != nil {
+			logger.Error().Err(err).Msg("unable to write authorization error response")
+		}
+		return
+	}
+
+	if timeout := handler.handlerTimeout(); timeout > 0 {
+		// Middlewares run outside the timeout, so they see the 504 Gateway Timeout answered when the handler overruns
+		var handlerDone <-chan struct{}
+		handler.middlewares.Then(func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+			handlerDone = RunWithTimeout(w, r, timeout, func(w http.ResponseWriter, r *http.Request) { handler.handlerFunc(accounts, w, r) })
+		})(accounts, w, r)
+		if handlerDone == nil {
+			return
+		}
+		// The concurrency slot is held until a handler that overran the timeout returns
+		releaseSlot := release
+		release = func() {}
+		go func() {
+			<-handlerDone
+			releaseSlot()
+		}()
+		return
+	}
+
+	handler.next(accounts, w, r)
+}
+
+// handlerTimeout The route timeout, or the default timeout for routes that are not streaming
+func (handler *RadixMiddleware) handlerTimeout() time.Duration {
+	if handler.routeTimeout != 0 {
+		return handler.routeTimeout
+	}
+	if handler.streaming {
+		return 0
+	}
+	return handler.timeout
+}
+
+func (handler *RadixMiddleware) limitRate(w http.ResponseWriter, r *http.Request, accounts models.Accounts) error {
+	if handler.rateLimiter == nil {
+		return nil
+	}
+
+	key := RateLimitKey(accounts, remoteIP(r))
+	if handler.rateLimit != nil {
+		key = RouteRateLimitKey(key, handler.Method, handler.Path)
+	}
+	return handler.rateLimiter.Allow(w, key, handler.rateLimit)
+}
+
+// concurrencyLimiter The limiter of the route pool, or the default limiter for routes that are not streaming
+func (handler *RadixMiddleware) concurrencyLimiter() *ConcurrencyLimiter {
+	if len(handler.pool) > 0 {
+		return handler.pools[handler.pool]
+	}
+	if handler.streaming {
+		return nil
+	}
+	return handler.concurrency
+}
+
+func (handler *RadixMiddleware) authorize(r *http.Request, accounts models.Accounts) error {
+	for _, authorizer := range handler.authorizers {
+		allowed, err := authorizer.Authorize(r, accounts)
+		if err != nil {
+			return httpUtils.UnexpectedError("Unable to authorize the request", err)
+		}
+		if !allowed {
+			return httpUtils.ForbiddenError("Access denied")
+		}
+	}
+	return nil
+}
+
+func (handler *RadixMiddleware) authenticate(r *http.Request) (models.Accounts, error) {
+	if handler.authentication == models.AuthenticationAnonymous {
+		return models.Accounts{}, nil
+	}
+
+	if handler.signedURL && handler.urlSigner != nil {
+		principal, ok, err := handler.urlSigner.Verify(r)
+		if err != nil {
+			return models.Accounts{}, &authenticationError{err: err, invalidSignature: true}
+		}
+		if ok {
+			return models.NewSignedURLAccounts(principal), nil
+		}
+	}
+
+	if handler.certificates != nil {
+		accounts, ok, err := handler.certificates.Authenticate(r)
+		if err != nil {
+			return models.Accounts{}, &authenticationError{err: err, invalidCertificate: true}
+		}
+		if ok {
+			return accounts, nil
+		}
+	}
+
+	token, err := httpUtils.GetBearerTokenFromHeader(r)
+	if err != nil || len(token) == 0 {
+		if handler.authentication == models.AuthenticationOptional && len(r.Header.Get("Authorization")) == 0 {
+			token = ""
+		} else {
+			return models.Accounts{}, &authenticationError{err: err}
+		}
 	}
 
 	impersonation, err := httpUtils.GetImpersonationFromHeader(r)
 	if err != nil {
-		if err := httpUtils.ErrorResponse(w, r, httpUtils.UnexpectedError("Problems impersonating", err)); err != nil {
-			logger.Error().Err(err).Msg("unable to write impersonating error response")
-		}
+		return models.Accounts{}, httpUtils.ValidationError("Impersonation", err.Error())
 	}
 
 	accounts := models.NewAccounts(
 		token,
 		impersonation)
 
-	handler.next(accounts, w, r)
+	if handler.tokenValidation != nil && len(token) > 0 {
+		if err := accounts.ValidateTokenLifetime(handler.tokenValidation.clock, handler.tokenValidation.leeway); err != nil {
+			return models.Accounts{}, &authenticationError{err: err, invalidToken: true}
+		}
+	}
+
+	if handler.tokenVerifier != nil && len(token) > 0 {
+		claims, err := handler.tokenVerifier(r.Context(), token)
+		if err != nil {
+			return models.Accounts{}, &authenticationError{err: err, invalidToken: true}
+		}
+		accounts = accounts.WithVerifiedClaims(claims)
+	}
+
+	return accounts, nil
+}
+
+// authenticationError Missing or invalid credentials
+type authenticationError struct {
+	err                error
+	invalidToken       bool
+	invalidCertificate bool
+	invalidSignature   bool
+}
+
+func (e *authenticationError) Error() string {
+	if e.err != nil {
+		return e.err.Error()
+	}
+	return "missing bearer token"
+}
+
+func (e *authenticationError) Unwrap() error {
+	return e.err
+}
+
+// authenticationErrorResponse Writes 401 Unauthorized with a WWW-Authenticate header as described in RFC 6750
+func authenticationErrorResponse(w http.ResponseWriter, r *http.Request, err error) error {
+	var authErr *authenticationError
+	if !errors.As(err, &authErr) {
+		return httpUtils.ErrorResponse(w, r, err)
+	}
+
+	if authErr.invalidCertificate {
+		zerolog.Ctx(r.Context()).Info().Err(authErr.err).Msg("client certificate rejected")
+		return httpUtils.ErrorResponse(w, r, httpUtils.UnauthorizedError("The client certificate is not valid"))
+	}
+
+	if authErr.invalidSignature {
+		if errors.Is(authErr.err, ErrSignedURLExpired) {
+			return httpUtils.ErrorResponse(w, r, httpUtils.UnauthorizedError("The signed URL expired"))
+		}
+		return httpUtils.ErrorResponse(w, r, httpUtils.UnauthorizedError("The URL signature is not valid"))
+	}
+
+	if !authErr.invalidToken {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		return httpUtils.ErrorResponse(w, r, httpUtils.UnauthorizedError("Missing or invalid authorization header"))
+	}
+
+	var description string
+	switch {
+	case errors.Is(authErr.err, jwt.ErrTokenExpired):
+		description = "The access token expired"
+	case errors.Is(authErr.err, jwt.ErrTokenNotValidYet), errors.Is(authErr.err, jwt.ErrTokenUsedBeforeIssued):
+		description = "The access token is not valid yet"
+	default:
+		description = "The access token is malformed"
+	}
+
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, description))
+	return httpUtils.ErrorResponse(w, r, httpUtils.UnauthorizedError(description))
 }
@@ -0,0 +1,232 @@
+package net
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	"github.com/equinor/radix-common/utils"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RadixMiddleware_TokenLifetimeValidation(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := utils.NewFakeClock(now)
+
+	tests := map[string]struct {
+		claims       jwt.MapClaims
+		expectedCode int
+		expectCalled bool
+	}{
+		"valid token": {
+			claims:       jwt.MapClaims{"exp": now.Add(time.Hour).Unix()},
+			expectedCode: http.StatusOK,
+			expectCalled: true,
+		},
+		"expired token": {
+			claims:       jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()},
+			expectedCode: http.StatusUnauthorized,
+		},
+		"expired token within leeway": {
+			claims:       jwt.MapClaims{"exp": now.Add(-10 * time.Second).Unix()},
+			expectedCode: http.StatusOK,
+			expectCalled: true,
+		},
+		"token not valid yet": {
+			claims:       jwt.MapClaims{"nbf": now.Add(time.Hour).Unix()},
+			expectedCode: http.StatusUnauthorized,
+		},
+		"token issued in the future": {
+			claims:       jwt.MapClaims{"iat": now.Add(time.Hour).Unix()},
+			expectedCode: http.StatusUnauthorized,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			called := false
+			sut := NewRadixMiddleware("/any", http.MethodGet, func(models.Accounts, http.ResponseWriter, *http.Request) { called = true }, nil,
+				WithTokenLifetimeValidation(clock, 30*time.Second))
+
+			req := httptest.NewRequest(http.MethodGet, "/any", nil)
+			req.Header.Set("Authorization", "Bearer "+newTestToken(t, test.claims))
+			w := httptest.NewRecorder()
+			sut.Handle(w, req)
+
+			assert.Equal(t, test.expectedCode, w.Code)
+			assert.Equal(t, test.expectCalled, called)
+			if !test.expectCalled {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), `Bearer error="invalid_token"`)
+			}
+		})
+	}
+}
+
+func Test_RadixMiddleware_FailsClosed(t *testing.T) {
+	tests := map[string]struct {
+		authentication models.AuthenticationMode
+		authorization  string
+		impersonation  string
+		expectedCode   int
+		expectedToken  string
+		expectCalled   bool
+	}{
+		"required without token": {
+			authentication: models.AuthenticationRequired,
+			expectedCode:   http.StatusUnauthorized,
+		},
+		"required with invalid header": {
+			authentication: models.AuthenticationRequired,
+			authorization:  "invalid",
+			expectedCode:   http.StatusUnauthorized,
+		},
+		"required with token": {
+			authentication: models.AuthenticationRequired,
+			authorization:  "Bearer any-token",
+			expectedCode:   http.StatusOK,
+			expectedToken:  "any-token",
+			expectCalled:   true,
+		},
+		"required with invalid impersonation": {
+			authentication: models.AuthenticationRequired,
+			authorization:  "Bearer any-token",
+			impersonation:  "any-user",
+			expectedCode:   http.StatusBadRequest,
+		},
+		"optional without token": {
+			authentication: models.AuthenticationOptional,
+			expectedCode:   http.StatusOK,
+			expectCalled:   true,
+		},
+		"optional with invalid header": {
+			authentication: models.AuthenticationOptional,
+			authorization:  "invalid",
+			expectedCode:   http.StatusUnauthorized,
+		},
+		"optional with token": {
+			authentication: models.AuthenticationOptional,
+			authorization:  "Bearer any-token",
+			expectedCode:   http.StatusOK,
+			expectedToken:  "any-token",
+			expectCalled:   true,
+		},
+		"anonymous ignores credentials": {
+			authentication: models.AuthenticationAnonymous,
+			authorization:  "invalid",
+			impersonation:  "any-user",
+			expectedCode:   http.StatusOK,
+			expectCalled:   true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			called := false
+			var actualToken string
+			route := models.Route{
+				Path:           "/any",
+				Method:         http.MethodGet,
+				Authentication: test.authentication,
+				HandlerFunc: func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+					called = true
+					actualToken = accounts.GetToken()
+				},
+			}
+			sut := NewRadixMiddlewareForRoute(route, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/any", nil)
+			if len(test.authorization) > 0 {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			if len(test.impersonation) > 0 {
+				req.Header.Set("Impersonate-User", test.impersonation)
+			}
+			w := httptest.NewRecorder()
+			sut.Handle(w, req)
+
+			assert.Equal(t, test.expectedCode, w.Code)
+			assert.Equal(t, test.expectCalled, called)
+			assert.Equal(t, test.expectedToken, actualToken)
+		})
+	}
+}
+
+type fakeAuthorizer struct {
+	allowed bool
+	err     error
+	calls   int
+}
+
+func (a *fakeAuthorizer) Authorize(*http.Request, models.Accounts) (bool, error) {
+	a.calls++
+	return a.allowed, a.err
+}
+
+func Test_RadixMiddleware_RouteAuthorization(t *testing.T) {
+	called := false
+	route := models.Route{
+		Path:          "/any",
+		Method:        http.MethodGet,
+		Authorization: []models.Authorizer{models.RequireGroups("radix-admins")},
+		HandlerFunc:   func(models.Accounts, http.ResponseWriter, *http.Request) { called = true },
+	}
+	verifier := models.JWTTokenVerifier(func(*jwt.Token) (interface{}, error) { return []byte("any-key"), nil }, jwt.WithValidMethods([]string{"HS256"}))
+	sut := NewRadixMiddlewareForRoute(route, nil, WithTokenVerifier(verifier))
+
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req.Header.Set("Authorization", "Bearer "+newTestToken(t, jwt.MapClaims{"groups": []string{"radix-users"}}))
+	req.Header.Set("Impersonate-User", "any-user")
+	req.Header.Set("Impersonate-Group", "radix-admins")
+	w := httptest.NewRecorder()
+	sut.Handle(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code, "Impersonated groups are not used")
+	assert.False(t, called)
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"groups": []string{"radix-admins"}}).SignedString([]byte("other-key"))
+	req = httptest.NewRequest(http.MethodGet, "/any", nil)
+	req.Header.Set("Authorization", "Bearer "+forged)
+	w = httptest.NewRecorder()
+	sut.Handle(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Forged tokens are rejected")
+	assert.False(t, called)
+
+	req.Header.Set("Authorization", "Bearer "+newTestToken(t, jwt.MapClaims{"groups": []string{"radix-admins"}}))
+	w = httptest.NewRecorder()
+	NewRadixMiddlewareForRoute(route, nil).Handle(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code, "Groups are not verified without a token verifier")
+	assert.False(t, called)
+
+	w = httptest.NewRecorder()
+	sut.Handle(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, called)
+}
+
+func Test_RadixMiddleware_PluggableAuthorizer(t *testing.T) {
+	route := models.Route{Path: "/any", Method: http.MethodGet, HandlerFunc: func(models.Accounts, http.ResponseWriter, *http.Request) {}}
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/any", nil)
+		req.Header.Set("Authorization", "Bearer any-token")
+		return req
+	}
+
+	authorizer := &fakeAuthorizer{allowed: false}
+	w := httptest.NewRecorder()
+	NewRadixMiddlewareForRoute(route, nil, WithAuthorizers(authorizer)).Handle(w, newRequest())
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, 1, authorizer.calls)
+
+	authorizer = &fakeAuthorizer{err: errors.New("any error")}
+	w = httptest.NewRecorder()
+	NewRadixMiddlewareForRoute(route, nil, WithAuthorizers(authorizer)).Handle(w, newRequest())
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	authorizer = &fakeAuthorizer{allowed: true}
+	w = httptest.NewRecorder()
+	NewRadixMiddlewareForRoute(route, nil, WithAuthorizers(authorizer)).Handle(w, newRequest())
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,223 @@
+package net
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/equinor/radix-common/utils"
+)
+
+// RateLimitResult Result of taking a token from a bucket
+type RateLimitResult struct {
+	Allowed bool
+	// Remaining Whole tokens left in the bucket
+	Remaining int
+	// RetryAfter Time until a token is available, when not allowed
+	RetryAfter time.Duration
+	// Reset Time until the bucket is full
+	Reset time.Duration
+}
+
+// RateLimitStore Holds the token bucket state of each key
+type RateLimitStore interface {
+	Take(key string, limit models.RateLimit, now time.Time) RateLimitResult
+}
+
+type tokenBucket struct {
+	key      string
+	tokens   float64
+	lastSeen time.Time
+}
+
+const (
+	// defaultMaxRateLimitBuckets Default max number of buckets in MemoryRateLimitStore
+	defaultMaxRateLimitBuckets = 100_000
+	// defaultRateLimitIdleTimeout Default idle timeout of buckets in MemoryRateLimitStore
+	defaultRateLimitIdleTimeout = 10 * time.Minute
+)
+
+// MemoryRateLimitStoreOption Option for MemoryRateLimitStore
+type MemoryRateLimitStoreOption func(*MemoryRateLimitStore)
+
+// WithMaxRateLimitBuckets Max number of buckets kept in the store. Defaults to 100 000
+func WithMaxRateLimitBuckets(maxBuckets int) MemoryRateLimitStoreOption {
+	return func(store *MemoryRateLimitStore) {
+		store.maxBuckets = maxBuckets
+	}
+}
+
+// MemoryRateLimitStore In-memory RateLimitStore, evicting buckets that have been idle longer than the idle timeout.
+// When the store is full, the least recently used bucket is evicted for a new key
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	// recent Buckets ordered from the most to the least recently used
+	recent      *list.List
+	idleTimeout time.Duration
+	maxBuckets  int
+}
+
+// NewMemoryRateLimitStore Constructor for MemoryRateLimitStore.
+// A non-positive idle timeout defaults to 10 minutes, and a non-positive max number of buckets to 100 000,
+// since a store keeping no buckets would not limit any requests
+func NewMemoryRateLimitStore(idleTimeout time.Duration, options ...MemoryRateLimitStoreOption) *MemoryRateLimitStore {
+	store := &MemoryRateLimitStore{
+		buckets:     map[string]*list.Element{},
+		recent:      list.New(),
+		idleTimeout: idleTimeout,
+		maxBuckets:  defaultMaxRateLimitBuckets,
+	}
+	for _, option := range options {
+		option(store)
+	}
+	if store.idleTimeout <= 0 {
+		store.idleTimeout = defaultRateLimitIdleTimeout
+	}
+	if store.maxBuckets <= 0 {
+		store.maxBuckets = defaultMaxRateLimitBuckets
+	}
+	return store
+}
+
+// Take Takes a token from the bucket of the key
+func (store *MemoryRateLimitStore) Take(key string, limit models.RateLimit, now time.Time) RateLimitResult {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.evictIdleBuckets(now)
+
+	burst := float64(limit.Burst)
+	element, ok := store.buckets[key]
+	if ok {
+		store.recent.MoveToFront(element)
+	} else {
+		if store.recent.Len() >= store.maxBuckets {
+			store.removeBucket(store.recent.Back())
+		}
+		element = store.recent.PushFront(&tokenBucket{key: key, tokens: burst, lastSeen: now})
+		store.buckets[key] = element
+	}
+	bucket := element.Value.(*tokenBucket)
+
+	if elapsed := now.Sub(bucket.lastSeen); elapsed > 0 {
+		bucket.tokens = math.Min(burst, bucket.tokens+elapsed.Seconds()*limit.RequestsPerSecond)
+	}
+	bucket.lastSeen = now
+
+	result := RateLimitResult{}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - bucket.tokens) / limit.RequestsPerSecond)
+	}
+	result.Remaining = int(bucket.tokens)
+	result.Reset = secondsToDuration((burst - bucket.tokens) / limit.RequestsPerSecond)
+	return result
+}
+
+// Len Number of buckets in the store
+func (store *MemoryRateLimitStore) Len() int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return len(store.buckets)
+}
+
+// evictIdleBuckets Removes idle buckets from the least recently used end, stopping at the first bucket in use
+func (store *MemoryRateLimitStore) evictIdleBuckets(now time.Time) {
+	for element := store.recent.Back(); element != nil; element = store.recent.Back() {
+		if now.Sub(element.Value.(*tokenBucket).lastSeen) < store.idleTimeout {
+			return
+		}
+		store.removeBucket(element)
+	}
+}
+
+func (store *MemoryRateLimitStore) removeBucket(element *list.Element) {
+	bucket := store.recent.Remove(element).(*tokenBucket)
+	delete(store.buckets, bucket.key)
+}
+
+// RateLimiter Token bucket rate limiter, keyed by the verified principal, or the client IP for other requests
+type RateLimiter struct {
+	limit models.RateLimit
+	store RateLimitStore
+	clock utils.Clock
+}
+
+// NewRateLimiter Constructor for RateLimiter. The limit is used for routes without their own rate limit.
+// Panics when the limit is not valid, see ValidateRateLimit
+func NewRateLimiter(limit models.RateLimit, store RateLimitStore, clock utils.Clock) *RateLimiter {
+	if err := ValidateRateLimit(limit); err != nil {
+		panic(fmt.Sprintf("rate limit: %v", err))
+	}
+	return &RateLimiter{
+		limit: limit,
+		store: store,
+		clock: clock,
+	}
+}
+
+// Allow Takes a token for the key, and sets the RateLimit-* headers.
+// Routes with their own limit must pass the limit and a key that includes the route.
+// When the limit is exceeded, Retry-After is set and a TooManyRequests error is returned
+func (limiter *RateLimiter) Allow(w http.ResponseWriter, key string, routeLimit *models.RateLimit) error {
+	limit := limiter.limit
+	if routeLimit != nil {
+		limit = *routeLimit
+	}
+
+	result := limiter.store.Take(key, limit, limiter.clock.Now())
+
+	header := w.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+	header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		return httpUtils.TooManyRequestsError("Rate limit exceeded")
+	}
+	return nil
+}
+
+// RateLimitKey Key of the verified principal in accounts, see WithTokenVerifier, or of the client IP for unverified and anonymous requests.
+// Unverified tokens are never used, since anyone can sign a token with the principal of another caller,
+// or send a new token with each request to get a new bucket
+func RateLimitKey(accounts models.Accounts, clientIP string) string {
+	if principal, ok := accounts.GetAuthenticatedPrincipal(); ok {
+		return "principal:" + principal
+	}
+	return "ip:" + clientIP
+}
+
+// ValidateRateLimit Returns an error when the rate or burst of the limit is not positive,
+// since a zero rate never refills the bucket, and a bucket without burst rejects every request
+func ValidateRateLimit(limit models.RateLimit) error {
+	if !(limit.RequestsPerSecond > 0) || math.IsInf(limit.RequestsPerSecond, 1) {
+		return fmt.Errorf("requests per second must be positive and finite, got %v", limit.RequestsPerSecond)
+	}
+	if limit.Burst <= 0 {
+		return fmt.Errorf("burst must be positive, got %d", limit.Burst)
+	}
+	return nil
+}
+
+// RouteRateLimitKey Key for routes with their own rate limit, so they don't share buckets with other routes
+func RouteRateLimitKey(key, method, path string) string {
+	return method + " " + path + "|" + key
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
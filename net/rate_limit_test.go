@@ -0,0 +1,214 @@
+package net
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	"github.com/equinor/radix-common/utils"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MemoryRateLimitStore_TokenBucket(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := models.RateLimit{RequestsPerSecond: 1, Burst: 2}
+	sut := NewMemoryRateLimitStore(time.Minute)
+
+	assert.True(t, sut.Take("any", limit, now).Allowed)
+	assert.True(t, sut.Take("any", limit, now).Allowed)
+	result := sut.Take("any", limit, now)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 2*time.Second, result.Reset)
+	assert.True(t, sut.Take("other", limit, now).Allowed, "Buckets are separate per key")
+
+	result = sut.Take("any", limit, now.Add(time.Second))
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+}
+
+func Test_MemoryRateLimitStore_EvictsIdleBuckets(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := models.RateLimit{RequestsPerSecond: 1, Burst: 2}
+	sut := NewMemoryRateLimitStore(time.Minute)
+
+	sut.Take("any", limit, now)
+	sut.Take("other", limit, now.Add(30*time.Second))
+	require.Equal(t, 2, sut.Len())
+
+	sut.Take("other", limit, now.Add(61*time.Second))
+	assert.Equal(t, 1, sut.Len())
+}
+
+func Test_MemoryRateLimitStore_MaxBuckets(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := models.RateLimit{RequestsPerSecond: 0.01, Burst: 1}
+	sut := NewMemoryRateLimitStore(time.Hour, WithMaxRateLimitBuckets(2))
+
+	sut.Take("oldest", limit, now)
+	sut.Take("any", limit, now.Add(time.Second))
+	sut.Take("other", limit, now.Add(2*time.Second))
+	assert.Equal(t, 2, sut.Len())
+	assert.False(t, sut.Take("any", limit, now.Add(2*time.Second)).Allowed, "Recently used buckets are kept")
+	assert.True(t, sut.Take("oldest", limit, now.Add(2*time.Second)).Allowed, "The least recently used bucket is evicted")
+}
+
+func Test_MemoryRateLimitStore_DefaultIdleTimeout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	limit := models.RateLimit{RequestsPerSecond: 0.01, Burst: 1}
+	for _, idleTimeout := range []time.Duration{0, -time.Minute} {
+		sut := NewMemoryRateLimitStore(idleTimeout)
+
+		assert.True(t, sut.Take("any", limit, now).Allowed)
+		assert.False(t, sut.Take("any", limit, now).Allowed, "Buckets are kept with idle timeout %v", idleTimeout)
+		assert.Equal(t, 1, sut.Len())
+	}
+}
+
+func Test_RadixMiddleware_RateLimiter(t *testing.T) {
+	clock := utils.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := NewRateLimiter(models.RateLimit{RequestsPerSecond: 1, Burst: 1}, NewMemoryRateLimitStore(time.Minute), clock)
+	handler := func(models.Accounts, http.ResponseWriter, *http.Request) {}
+	verifier := models.JWTTokenVerifier(func(*jwt.Token) (interface{}, error) { return []byte("any-key"), nil }, jwt.WithValidMethods([]string{"HS256"}))
+	sut := NewRadixMiddlewareForRoute(models.Route{Path: "/any", Method: http.MethodGet, HandlerFunc: handler}, nil, WithRateLimiter(limiter), WithTokenVerifier(verifier))
+	newRequest := func(upn string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/any", nil)
+		req.Header.Set("Authorization", "Bearer "+newTestToken(t, jwt.MapClaims{"upn": upn}))
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	sut.Handle(w, newRequest("user1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = httptest.NewRecorder()
+	sut.Handle(w, newRequest("user1"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	sut.Handle(w, newRequest("user2"))
+	assert.Equal(t, http.StatusOK, w.Code, "Other verified principals have their own bucket")
+
+	clock.Advance(time.Second)
+	w = httptest.NewRecorder()
+	sut.Handle(w, newRequest("user1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func Test_RadixMiddleware_RouteRateLimit(t *testing.T) {
+	clock := utils.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := NewRateLimiter(models.RateLimit{RequestsPerSecond: 1, Burst: 1}, NewMemoryRateLimitStore(time.Minute), clock)
+	handler := func(models.Accounts, http.ResponseWriter, *http.Request) {}
+	route := models.Route{
+		Path:           "/public",
+		Method:         http.MethodGet,
+		Authentication: models.AuthenticationAnonymous,
+		RateLimit:      &models.RateLimit{RequestsPerSecond: 1, Burst: 2},
+		HandlerFunc:    handler,
+	}
+	sut := NewRadixMiddlewareForRoute(route, nil, WithRateLimiter(limiter))
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		sut.Handle(w, httptest.NewRequest(http.MethodGet, "/public", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	w := httptest.NewRecorder()
+	sut.Handle(w, httptest.NewRequest(http.MethodGet, "/public", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/public", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w = httptest.NewRecorder()
+	sut.Handle(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "Anonymous requests are limited per client IP")
+}
+
+func Test_RateLimitKey(t *testing.T) {
+	claims := jwt.MapClaims{"upn": "victim@equinor.com"}
+	token := newTestToken(t, claims)
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("other-key"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "ip:10.0.0.1", RateLimitKey(models.NewAccounts(token, models.Impersonation{}), "10.0.0.1"), "Unverified tokens are keyed by the client IP")
+	assert.Equal(t, "ip:10.0.0.1", RateLimitKey(models.NewAccounts(forged, models.Impersonation{}), "10.0.0.1"))
+
+	verified := models.NewAccounts(token, models.Impersonation{}).WithVerifiedClaims(claims)
+	assert.Equal(t, "principal:victim@equinor.com", RateLimitKey(verified, "10.0.0.1"))
+	assert.Equal(t, "ip:10.0.0.1", RateLimitKey(models.Accounts{}, "10.0.0.1"))
+}
+
+func Test_RadixMiddleware_RateLimiterRotatedTokens(t *testing.T) {
+	clock := utils.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	store := NewMemoryRateLimitStore(time.Minute)
+	limiter := NewRateLimiter(models.RateLimit{RequestsPerSecond: 1, Burst: 1}, store, clock)
+	handler := func(models.Accounts, http.ResponseWriter, *http.Request) {}
+	sut := NewRadixMiddlewareForRoute(models.Route{Path: "/any", Method: http.MethodGet, HandlerFunc: handler}, nil, WithRateLimiter(limiter))
+
+	allowed := 0
+	for i := range 100 {
+		req := httptest.NewRequest(http.MethodGet, "/any", nil)
+		req.Header.Set("Authorization", "Bearer "+newTestToken(t, jwt.MapClaims{"upn": "user", "jti": i}))
+		w := httptest.NewRecorder()
+		sut.Handle(w, req)
+		if w.Code == http.StatusOK {
+			allowed++
+		}
+	}
+	assert.Equal(t, 1, allowed, "A new unverified token does not get a new bucket")
+	assert.Equal(t, 1, store.Len())
+}
+
+func Test_RadixMiddleware_RateLimiterBehindProxy(t *testing.T) {
+	clock := utils.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := NewRateLimiter(models.RateLimit{RequestsPerSecond: 1, Burst: 1}, NewMemoryRateLimitStore(time.Minute), clock)
+	resolver, err := NewClientIPResolver("10.0.0.0/8")
+	require.NoError(t, err)
+	route := models.Route{Path: "/public", Method: http.MethodGet, Authentication: models.AuthenticationAnonymous, HandlerFunc: func(models.Accounts, http.ResponseWriter, *http.Request) {}}
+	sut := NewRadixMiddlewareForRoute(route, nil, WithRateLimiter(limiter), WithClientIPResolver(resolver))
+	newRequest := func(forwardedFor string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/public", nil)
+		req.RemoteAddr = "10.0.0.5:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	sut.Handle(w, newRequest("203.0.113.1"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	sut.Handle(w, newRequest("203.0.113.2"))
+	assert.Equal(t, http.StatusOK, w.Code, "Clients behind the ingress have their own bucket")
+
+	w = httptest.NewRecorder()
+	sut.Handle(w, newRequest("203.0.113.1"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func Test_ValidateRateLimit(t *testing.T) {
+	assert.NoError(t, ValidateRateLimit(models.RateLimit{RequestsPerSecond: 0.5, Burst: 1}))
+	invalidLimits := map[string]models.RateLimit{
+		"zero rate":     {RequestsPerSecond: 0, Burst: 1},
+		"negative rate": {RequestsPerSecond: -1, Burst: 1},
+		"infinite rate": {RequestsPerSecond: math.Inf(1), Burst: 1},
+		"NaN rate":      {RequestsPerSecond: math.NaN(), Burst: 1},
+		"zero burst":    {RequestsPerSecond: 1, Burst: 0},
+	}
+	for name, limit := range invalidLimits {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, ValidateRateLimit(limit))
+			assert.Panics(t, func() { NewRateLimiter(limit, NewMemoryRateLimitStore(time.Minute), utils.RealClock{}) })
+			route := models.Route{Path: "/any", RateLimit: &limit, HandlerFunc: func(models.Accounts, http.ResponseWriter, *http.Request) {}}
+			assert.Panics(t, func() { NewRadixMiddlewareForRoute(route, nil) }, "Route rate limits are validated when the route is registered")
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package net
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/rs/zerolog"
+)
+
+// Recovery Wraps a http.Handler with panic recovery, see HandlePanic
+func Recovery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer RecoverPanic(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RecoverPanic Recovers a panic and handles it with HandlePanic. Must be called with defer
+func RecoverPanic(w http.ResponseWriter, r *http.Request) {
+	if recovered := recover(); recovered != nil {
+		HandlePanic(w, r, recovered)
+	}
+}
+
+// HandlePanic Logs the recovered panic with stack trace to the zerolog logger in the request context,
+// and answers with a server error through the standard error response, unless the response is already written.
+// The stack of a *HandlerPanic is the stack of the handler that panicked, see RunWithTimeout.
+// http.ErrAbortHandler is re-raised, so net/http can abort the response
+func HandlePanic(w http.ResponseWriter, r *http.Request, recovered any) {
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+
+	stack := debug.Stack()
+	if handlerPanic, ok := recovered.(*HandlerPanic); ok {
+		recovered, stack = handlerPanic.Value, handlerPanic.Stack
+	}
+	logger := zerolog.Ctx(r.Context())
+	logger.Error().
+		Interface("panic", recovered).
+		Str("stack", string(stack)).
+		Msg("recovered from panic")
+
+	if written, ok := w.(interface{ Written() bool }); ok && written.Written() {
+		return
+	}
+	if err := httpUtils.ErrorResponse(w, r, httpUtils.UnexpectedError("Internal server error", nil)); err != nil {
+		logger.Error().Err(err).Msg("unable to write panic error response")
+	}
+}
@@ -0,0 +1,67 @@
+package net
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RadixMiddleware_PanicRecovery(t *testing.T) {
+	var logOutput bytes.Buffer
+	logger := zerolog.New(&logOutput)
+	handledCalled := false
+	route := models.Route{
+		Path:           "/any",
+		Method:         http.MethodGet,
+		Authentication: models.AuthenticationAnonymous,
+		HandlerFunc:    func(models.Accounts, http.ResponseWriter, *http.Request) { panic("any panic") },
+	}
+	sut := NewRadixMiddlewareForRoute(route, func(*RadixMiddleware, http.ResponseWriter, *http.Request, time.Time) { handledCalled = true }, WithPanicRecovery())
+
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req = req.WithContext(logger.WithContext(req.Context()))
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	sut.Handle(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"type":"server","message":"Internal server error"}`, w.Body.String())
+	assert.Contains(t, logOutput.String(), `"panic":"any panic"`)
+	assert.Contains(t, logOutput.String(), `"stack":`)
+	assert.True(t, handledCalled)
+}
+
+func Test_RadixMiddleware_PanicRecoveryWithTimeout(t *testing.T) {
+	var logOutput bytes.Buffer
+	logger := zerolog.New(&logOutput)
+	route := models.Route{
+		Path:           "/any",
+		Method:         http.MethodGet,
+		Authentication: models.AuthenticationAnonymous,
+		HandlerFunc:    func(_ models.Accounts, w http.ResponseWriter, r *http.Request) { panickingHandler(w, r) },
+	}
+	sut := NewRadixMiddlewareForRoute(route, nil, WithPanicRecovery(), WithTimeout(time.Second))
+
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req = req.WithContext(logger.WithContext(req.Context()))
+	w := httptest.NewRecorder()
+	sut.Handle(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, logOutput.String(), `"panic":"any panic"`)
+	assert.Contains(t, logOutput.String(), "panickingHandler", "The logged stack is the stack of the handler")
+}
+
+func Test_Recovery_ReraisesErrAbortHandler(t *testing.T) {
+	sut := Recovery(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic(http.ErrAbortHandler) }))
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		sut.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/any", nil))
+	})
+}
@@ -0,0 +1,56 @@
+package net
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ZerologRequestLogger returns a handled callback for NewRadixMiddleware, that logs request and response
+// using the zerolog logger from the request context. Mirrors pkg/gin.ZerologRequestLogger.
+// The remote address is the client IP resolved by WithClientIPResolver
+func ZerologRequestLogger() func(*RadixMiddleware, http.ResponseWriter, *http.Request, time.Time) {
+	return func(handler *RadixMiddleware, w http.ResponseWriter, r *http.Request, startTime time.Time) {
+		logger := zerolog.Ctx(r.Context())
+		elapsed := time.Since(startTime)
+
+		var status int
+		var bodySize int64
+		var firstByte time.Time
+		if recorder, ok := w.(*ResponseRecorder); ok {
+			status, bodySize, firstByte = recorder.Status(), recorder.BytesWritten(), recorder.FirstByteTime()
+		}
+		// net/http answers 200 OK when the handler writes nothing, like the status of the gin response writer
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		var ev *zerolog.Event
+		switch {
+		case status >= 400 && status <= 499:
+			ev = logger.Warn() //nolint:zerologlint
+		case status >= 500:
+			ev = logger.Error() //nolint:zerologlint
+		default:
+			ev = logger.Info() //nolint:zerologlint
+		}
+
+		if !firstByte.IsZero() {
+			ev = ev.Int64("first_byte_ms", firstByte.Sub(startTime).Milliseconds())
+		}
+
+		ev.
+			Str("remote_addr", remoteIP(r)).
+			Str("referer", r.Referer()).
+			Str("method", r.Method).
+			Str("path", r.URL.Path).
+			Str("route", handler.Path).
+			Str("query", r.URL.RawQuery).
+			Int("status", status).
+			Int64("body_size", bodySize).
+			Int64("elapsed_ms", elapsed.Milliseconds()).
+			Str("user_agent", r.UserAgent()).
+			Msg(http.StatusText(status))
+	}
+}
@@ -0,0 +1,140 @@
+package net
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	httpUtils "github.com/equinor/radix-common/net/http"
+)
+
+// ResponseRecorder Wraps a http.ResponseWriter, and records the status code, the number of bytes written
+// and the time the first byte was written. Flush, Hijack and ReadFrom are passed on to the wrapped writer
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status        int
+	bytesWritten  int64
+	firstByteTime time.Time
+	errorType     httpUtils.Type
+	// request The request with the warnings written before the status code, see httpUtils.AddWarning
+	request *http.Request
+}
+
+// NewResponseRecorder Constructor for ResponseRecorder
+func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
+	return &ResponseRecorder{ResponseWriter: w}
+}
+
+// Status The status code written, http.StatusOK when the body is written without a status code, or 0 when nothing is written
+func (rec *ResponseRecorder) Status() int {
+	return rec.status
+}
+
+// BytesWritten The number of body bytes written
+func (rec *ResponseRecorder) BytesWritten() int64 {
+	return rec.bytesWritten
+}
+
+// FirstByteTime The time the status code or the first byte of the body was written, or zero time when nothing is written
+func (rec *ResponseRecorder) FirstByteTime() time.Time {
+	return rec.firstByteTime
+}
+
+// ErrorType The Type of the error written by net/http.ErrorResponse, or empty when no error is written
+func (rec *ResponseRecorder) ErrorType() httpUtils.Type {
+	return rec.errorType
+}
+
+// RecordErrorType Records the Type of the error written by net/http.ErrorResponse, and passes it on to the wrapped writer
+func (rec *ResponseRecorder) RecordErrorType(errorType httpUtils.Type) {
+	rec.errorType = errorType
+	if recorder, ok := rec.ResponseWriter.(httpUtils.ErrorTypeRecorder); ok {
+		recorder.RecordErrorType(errorType)
+	}
+}
+
+// Written Reports whether the status code or body is written
+func (rec *ResponseRecorder) Written() bool {
+	return rec.status != 0
+}
+
+// WriteHeader Records and writes the status code
+func (rec *ResponseRecorder) WriteHeader(code int) {
+	if rec.status == 0 && code >= http.StatusOK {
+		httpUtils.WriteWarnings(rec.ResponseWriter, rec.request)
+		rec.status = code
+		rec.firstByteTime = time.Now()
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Write Records and writes the body
+func (rec *ResponseRecorder) Write(p []byte) (int, error) {
+	rec.markWritten()
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytesWritten += int64(n)
+	return n, err
+}
+
+// ReadFrom Copies from the reader to the wrapped writer, using io.ReaderFrom when supported
+func (rec *ResponseRecorder) ReadFrom(r io.Reader) (int64, error) {
+	rec.markWritten()
+	var n int64
+	var err error
+	if readerFrom, ok := rec.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = readerFrom.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{rec.ResponseWriter}, r)
+	}
+	rec.bytesWritten += n
+	return n, err
+}
+
+// Flush Flushes the wrapped writer, if it supports http.Flusher
+func (rec *ResponseRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		rec.markWritten()
+		flusher.Flush()
+	}
+}
+
+// Hijack Hijacks the connection of the wrapped writer, if it supports http.Hijacker
+func (rec *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+		rec.firstByteTime = time.Now()
+	}
+	return conn, rw, err
+}
+
+// Unwrap Returns the wrapped writer, used by http.ResponseController
+func (rec *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// setWarningsRequest Sets the request with the warnings written before the status code,
+// also for responses not written by the response helpers, e.g. ReaderResponse or direct writes
+func (rec *ResponseRecorder) setWarningsRequest(r *http.Request) {
+	rec.request = r
+}
+
+func (rec *ResponseRecorder) markWritten() {
+	if rec.status == 0 {
+		httpUtils.WriteWarnings(rec.ResponseWriter, rec.request)
+		rec.status = http.StatusOK
+		rec.firstByteTime = time.Now()
+	}
+}
+
+// writerOnly Hides optional interfaces of the writer, so io.Copy does not call ReadFrom recursively
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,164 @@
+package net
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ResponseRecorder_RecordsStatusAndSize(t *testing.T) {
+	sut := NewResponseRecorder(httptest.NewRecorder())
+	assert.False(t, sut.Written())
+	assert.True(t, sut.FirstByteTime().IsZero())
+
+	sut.WriteHeader(http.StatusCreated)
+	_, _ = sut.Write([]byte("any"))
+	n, err := sut.ReadFrom(strings.NewReader("body"))
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(4), n)
+	assert.Equal(t, http.StatusCreated, sut.Status())
+	assert.Equal(t, int64(7), sut.BytesWritten())
+	assert.False(t, sut.FirstByteTime().IsZero())
+	assert.True(t, sut.Written())
+}
+
+func Test_ResponseRecorder_ImplicitStatus(t *testing.T) {
+	sut := NewResponseRecorder(httptest.NewRecorder())
+	_, _ = sut.Write([]byte("any"))
+	assert.Equal(t, http.StatusOK, sut.Status())
+}
+
+func Test_ResponseRecorder_SupportsOptionalInterfaces(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sut := NewResponseRecorder(w)
+		if r.URL.Path == "/hijack" {
+			conn, rw, err := http.NewResponseController(sut).Hijack()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+			_, _ = rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+			_ = rw.Flush()
+			return
+		}
+		_, _ = sut.Write([]byte("flushed"))
+		_ = http.NewResponseController(sut).Flush()
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/flush")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "flushed", string(body))
+
+	resp, err = http.Get(server.URL + "/hijack")
+	require.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "hijacked", string(body))
+
+	_, _, err = NewResponseRecorder(struct{ http.ResponseWriter }{httptest.NewRecorder()}).Hijack()
+	assert.Error(t, err)
+}
+
+func Test_RadixMiddleware_HandledReceivesRecorder(t *testing.T) {
+	var logOutput bytes.Buffer
+	logger := zerolog.New(&logOutput)
+	route := models.Route{
+		Path:           "/applications/{appName}",
+		Method:         http.MethodGet,
+		Authentication: models.AuthenticationAnonymous,
+		HandlerFunc: func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+			_ = httpUtils.ErrorResponse(w, r, httpUtils.NotFoundError("not found"))
+		},
+	}
+	sut := NewRadixMiddlewareForRoute(route, ZerologRequestLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/applications/any-app", nil)
+	req = req.WithContext(logger.WithContext(req.Context()))
+	sut.Handle(httptest.NewRecorder(), req)
+
+	assert.Contains(t, logOutput.String(), `"level":"warn"`)
+	assert.Contains(t, logOutput.String(), `"status":404`)
+	assert.Contains(t, logOutput.String(), `"body_size":10`)
+	assert.Contains(t, logOutput.String(), `"route":"/applications/{appName}"`)
+	assert.Contains(t, logOutput.String(), `"path":"/applications/any-app"`)
+	assert.Contains(t, logOutput.String(), `"message":"Not Found"`)
+
+	var recorder *ResponseRecorder
+	sut = NewRadixMiddlewareForRoute(route, func(_ *RadixMiddleware, w http.ResponseWriter, _ *http.Request, _ time.Time) {
+		recorder, _ = w.(*ResponseRecorder)
+	})
+	sut.Handle(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/applications/any-app", nil))
+	require.NotNil(t, recorder)
+	assert.Equal(t, http.StatusNotFound, recorder.Status())
+}
+
+func Test_ZerologRequestLogger_ClientIPAndImplicitStatus(t *testing.T) {
+	var logOutput bytes.Buffer
+	logger := zerolog.New(&logOutput)
+	resolver, err := NewClientIPResolver("10.0.0.0/8")
+	require.NoError(t, err)
+	route := models.Route{
+		Path:           "/any",
+		Method:         http.MethodGet,
+		Authentication: models.AuthenticationAnonymous,
+		HandlerFunc:    func(models.Accounts, http.ResponseWriter, *http.Request) {},
+	}
+	sut := NewRadixMiddlewareForRoute(route, ZerologRequestLogger(), WithClientIPResolver(resolver))
+
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	req = req.WithContext(logger.WithContext(req.Context()))
+	sut.Handle(httptest.NewRecorder(), req)
+
+	assert.Contains(t, logOutput.String(), `"level":"info"`)
+	assert.Contains(t, logOutput.String(), `"remote_addr":"203.0.113.1"`, "The resolved client IP is logged without port")
+	assert.Contains(t, logOutput.String(), `"status":200`, "A response without a written status is 200 OK")
+	assert.Contains(t, logOutput.String(), `"message":"OK"`)
+}
+
+func Test_RadixMiddleware_WritesWarningsOfAllResponses(t *testing.T) {
+	handlers := map[string]models.RadixHandlerFunc{
+		"reader response": func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+			httpUtils.AddWarning(r.Context(), "the file is deprecated")
+			_ = httpUtils.ReaderResponse(w, strings.NewReader("content"), "text/plain")
+		},
+		"direct write": func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+			httpUtils.AddWarning(r.Context(), "the file is deprecated")
+			_, _ = w.Write([]byte("content"))
+		},
+		"status code": func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+			httpUtils.AddWarning(r.Context(), "the file is deprecated")
+			w.WriteHeader(http.StatusNoContent)
+		},
+		"response helper": func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+			httpUtils.AddWarning(r.Context(), "the file is deprecated")
+			_ = httpUtils.StringResponse(w, r, "content")
+		},
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			for _, options := range [][]RadixMiddlewareOption{nil, {WithTimeout(time.Second)}} {
+				route := models.Route{Path: "/file", Method: http.MethodGet, Authentication: models.AuthenticationAnonymous, HandlerFunc: handler}
+				w := httptest.NewRecorder()
+				NewRadixMiddlewareForRoute(route, nil, options...).Handle(w, httptest.NewRequest(http.MethodGet, "/file", nil))
+				assert.Equal(t, []string{`299 - "the file is deprecated"`}, w.Header().Values("Warning"))
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package net
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+)
+
+// Router Registers the routes of controllers on a http.ServeMux, each route wrapped in RadixMiddleware.
+// Routes use method and path patterns as described in http.ServeMux, e.g. /applications/{appName},
+// and handlers read path parameters with r.PathValue or net/http.GetPathParam.
+// Requests with a method not registered for a path are answered with 405 Method Not Allowed and an Allow header
+type Router struct {
+	mux     *http.ServeMux
+	handled func(*RadixMiddleware, http.ResponseWriter, *http.Request, time.Time)
+	options []RadixMiddlewareOption
+	cors    *CORSPolicy
+
+	mu      sync.RWMutex
+	methods map[string][]string
+	// preflightPaths Paths with a registered preflight handler
+	preflightPaths map[string]bool
+	// optionsHandlers OPTIONS routes added after the preflight handler of the path, called by the preflight handler
+	optionsHandlers map[string]http.HandlerFunc
+}
+
+// NewRouter Constructor for Router. The handled callback and the options are passed to the RadixMiddleware of every route
+func NewRouter(handled func(*RadixMiddleware, http.ResponseWriter, *http.Request, time.Time), options ...RadixMiddlewareOption) *Router {
+	probe := NewRadixMiddleware("", "", nil, nil, options...)
+	return &Router{
+		mux:     http.NewServeMux(),
+		handled: handled,
+		options: options,
+		cors:    probe.cors,
+		methods: map[string][]string{},
+
+		preflightPaths:  map[string]bool{},
+		optionsHandlers: map[string]http.HandlerFunc{},
+	}
+}
+
+// AddControllers Registers the routes of the controllers, see models.ControllerRoutes.
+// Panics if a route conflicts with an already registered route, like http.ServeMux.Handle
+func (router *Router) AddControllers(controllers ...models.Controller) *Router {
+	for _, controller := range controllers {
+		router.AddRoutes(models.ControllerRoutes(controller))
+	}
+	return router
+}
+
+// AddRoutes Registers the routes.
+// Panics if a route conflicts with an already registered route, like http.ServeMux.Handle
+func (router *Router) AddRoutes(routes models.Routes) *Router {
+	for _, route := range routes {
+		router.addRoute(route)
+	}
+	return router
+}
+
+// ServeHTTP Dispatches the request to the route matching the method and path
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	router.mux.ServeHTTP(w, r)
+}
+
+func (router *Router) addRoute(route models.Route) {
+	method := strings.ToUpper(route.Method)
+	pattern := route.Path
+	if len(method) > 0 {
+		pattern = method + " " + route.Path
+	}
+	handler := NewRadixMiddlewareForRoute(route, router.handled, router.options...).Handle
+
+	router.mu.Lock()
+	defer router.mu.Unlock()
+	if method == http.MethodOptions && router.preflightPaths[route.Path] {
+		// The OPTIONS pattern of the path is taken by the preflight handler, which passes requests on to the route
+		if _, ok := router.optionsHandlers[route.Path]; ok {
+			panic("net: pattern " + pattern + " conflicts with an already registered route")
+		}
+		router.optionsHandlers[route.Path] = handler
+	} else {
+		router.mux.HandleFunc(pattern, handler)
+	}
+
+	_, pathRegistered := router.methods[route.Path]
+	router.methods[route.Path] = append(router.methods[route.Path], method)
+
+	if router.cors != nil && !pathRegistered && len(method) > 0 && method != http.MethodOptions {
+		router.mux.HandleFunc(http.MethodOptions+" "+route.Path, router.preflightHandler(route.Path))
+		router.preflightPaths[route.Path] = true
+	}
+}
+
+// preflightHandler Answers CORS preflight requests for a path, and other OPTIONS requests with 405 Method Not Allowed.
+// Requests are passed on to the OPTIONS route of the path, when it is added after the preflight handler
+func (router *Router) preflightHandler(path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		router.mu.RLock()
+		optionsHandler := router.optionsHandlers[path]
+		router.mu.RUnlock()
+		if optionsHandler != nil {
+			optionsHandler(w, r)
+			return
+		}
+		if router.cors.Apply(w, r) {
+			return
+		}
+		w.Header().Set("Allow", strings.Join(router.allowedMethods(path), ", "))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (router *Router) allowedMethods(path string) []string {
+	router.mu.RLock()
+	defer router.mu.RUnlock()
+
+	methods := append([]string{http.MethodOptions}, router.methods[path]...)
+	for _, method := range router.methods[path] {
+		if method == http.MethodGet {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
@@ -0,0 +1,259 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testController struct {
+	routes models.Routes
+}
+
+func (c testController) GetRoutes() models.Routes {
+	return c.routes
+}
+
+func Test_Router_RoutesByMethodAndPath(t *testing.T) {
+	var actualAppName string
+	var actualJobIndex int
+	controller := testController{routes: models.Routes{
+		{
+			Path:   "/applications/{appName}/jobs/{jobIndex}",
+			Method: http.MethodGet,
+			HandlerFunc: func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+				actualAppName, _ = httpUtils.GetPathParam[string](r, "appName")
+				jobIndex, err := httpUtils.GetPathParam[int](r, "jobIndex")
+				if err != nil {
+					_ = httpUtils.ErrorResponse(w, r, err)
+					return
+				}
+				actualJobIndex = jobIndex
+				_ = httpUtils.StringResponse(w, r, accounts.GetToken())
+			},
+		},
+		{
+			Path:           "/health",
+			Method:         http.MethodGet,
+			Authentication: models.AuthenticationAnonymous,
+			HandlerFunc: func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+				_ = httpUtils.StringResponse(w, r, "ok")
+			},
+		},
+	}}
+	sut := NewRouter(nil).AddControllers(controller)
+
+	req := httptest.NewRequest(http.MethodGet, "/applications/any-app/jobs/3", nil)
+	req.Header.Set("Authorization", "Bearer any-token")
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "any-token", w.Body.String())
+	assert.Equal(t, "any-app", actualAppName)
+	assert.Equal(t, 3, actualJobIndex)
+
+	req = httptest.NewRequest(http.MethodGet, "/applications/any-app/jobs/not-a-number", nil)
+	req.Header.Set("Authorization", "Bearer any-token")
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_Router_MethodNotAllowed(t *testing.T) {
+	handler := func(models.Accounts, http.ResponseWriter, *http.Request) {}
+	sut := NewRouter(nil).AddRoutes(models.Routes{
+		{Path: "/applications/{appName}", Method: http.MethodGet, HandlerFunc: handler},
+		{Path: "/applications/{appName}", Method: http.MethodDelete, HandlerFunc: handler},
+	})
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/applications/any-app", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "DELETE, GET, HEAD", w.Header().Get("Allow"))
+}
+
+func Test_Router_CORSPreflight(t *testing.T) {
+	handler := func(models.Accounts, http.ResponseWriter, *http.Request) {}
+	policy := &CORSPolicy{AllowedOrigins: []string{"https://console.radix.equinor.com"}, AllowedMethods: []string{http.MethodGet, http.MethodDelete}}
+	sut := NewRouter(nil, WithCORSPolicy(policy)).AddRoutes(models.Routes{
+		{Path: "/applications/{appName}", Method: http.MethodGet, HandlerFunc: handler},
+		{Path: "/applications/{appName}", Method: http.MethodDelete, HandlerFunc: handler},
+	})
+
+	req := httptest.NewRequest(http.MethodOptions, "/applications/any-app", nil)
+	req.Header.Set("Origin", "https://console.radix.equinor.com")
+	req.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/applications/any-app", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", w.Header().Get("Allow"))
+}
+
+func Test_Router_CORSWithOptionsRoute(t *testing.T) {
+	handler := func(models.Accounts, http.ResponseWriter, *http.Request) {}
+	optionsHandler := func(_ models.Accounts, w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusOK)
+	}
+	policy := &CORSPolicy{AllowedOrigins: []string{"https://console.radix.equinor.com"}, AllowedMethods: []string{http.MethodGet}}
+	for name, routes := range map[string]models.Routes{
+		"options route last": {
+			{Path: "/applications", Method: http.MethodGet, HandlerFunc: handler},
+			{Path: "/applications", Method: http.MethodOptions, Authentication: models.AuthenticationAnonymous, HandlerFunc: optionsHandler},
+		},
+		"options route first": {
+			{Path: "/applications", Method: http.MethodOptions, Authentication: models.AuthenticationAnonymous, HandlerFunc: optionsHandler},
+			{Path: "/applications", Method: http.MethodGet, HandlerFunc: handler},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var sut *Router
+			require.NotPanics(t, func() { sut = NewRouter(nil, WithCORSPolicy(policy)).AddRoutes(routes) })
+
+			w := httptest.NewRecorder()
+			sut.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/applications", nil))
+			assert.Equal(t, http.StatusOK, w.Code, "OPTIONS requests are handled by the route")
+			assert.Equal(t, "GET, OPTIONS", w.Header().Get("Allow"))
+
+			req := httptest.NewRequest(http.MethodOptions, "/applications", nil)
+			req.Header.Set("Origin", "https://console.radix.equinor.com")
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			w = httptest.NewRecorder()
+			sut.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusNoContent, w.Code, "Preflight requests are answered by the CORS policy")
+		})
+	}
+
+	assert.Panics(t, func() {
+		NewRouter(nil, WithCORSPolicy(policy)).AddRoutes(models.Routes{
+			{Path: "/applications", Method: http.MethodGet, HandlerFunc: handler},
+			{Path: "/applications", Method: http.MethodOptions, HandlerFunc: optionsHandler},
+			{Path: "/applications", Method: http.MethodOptions, HandlerFunc: optionsHandler},
+		})
+	}, "Duplicate OPTIONS routes conflict")
+}
+
+func Test_Router_Middlewares(t *testing.T) {
+	var trace []string
+	middleware := func(name string) models.Middleware {
+		return func(next models.RadixHandlerFunc) models.RadixHandlerFunc {
+			return func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				next(accounts, w, r)
+			}
+		}
+	}
+	group := models.RouteGroup{
+		Prefix:      "/api",
+		Middlewares: []models.Middleware{middleware("group")},
+		Routes: models.Routes{{
+			Path:           "/any",
+			Method:         http.MethodGet,
+			Authentication: models.AuthenticationAnonymous,
+			Middlewares:    []models.Middleware{middleware("route")},
+			HandlerFunc: func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, "handler")
+				_ = httpUtils.StringResponse(w, r, "ok")
+			},
+		}},
+	}
+	sut := NewRouter(nil, WithMiddlewares(middleware("global"))).AddControllers(group)
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/any", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"global", "group", "route", "handler"}, trace)
+
+	trace = nil
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/any", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Empty(t, trace)
+}
+
+func Test_Router_DeprecatedRoute(t *testing.T) {
+	handler := func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		httpUtils.AddWarning(r.Context(), "the name field is ignored")
+		_ = httpUtils.StringResponse(w, r, "ok")
+	}
+	sut := NewRouter(nil).AddRoutes(models.Routes{
+		{
+			Path:           "/v1/apps",
+			Method:         http.MethodGet,
+			Authentication: models.AuthenticationAnonymous,
+			HandlerFunc:    handler,
+			Deprecation: &models.Deprecation{
+				Date:        time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+				Sunset:      time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC),
+				Replacement: "/v2/apps",
+			},
+		},
+		{
+			Path:           "/v2/apps",
+			Method:         http.MethodGet,
+			Authentication: models.AuthenticationAnonymous,
+			HandlerFunc:    handler,
+		},
+	})
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/apps", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "@1767225600", w.Header().Get("Deprecation"))
+	assert.Equal(t, "Thu, 31 Dec 2026 00:00:00 GMT", w.Header().Get("Sunset"))
+	assert.Equal(t, `</v2/apps>; rel="successor-version"`, w.Header().Get("Link"))
+	assert.Equal(t, []string{
+		`299 - "GET /v1/apps is deprecated and will be removed after 2026-12-31, use /v2/apps instead"`,
+		`299 - "the name field is ignored"`,
+	}, w.Header().Values("Warning"))
+
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/apps", nil))
+	assert.Empty(t, w.Header().Get("Deprecation"))
+	assert.Equal(t, []string{`299 - "the name field is ignored"`}, w.Header().Values("Warning"))
+}
+
+func Test_Router_DeprecationWarningThroughContext(t *testing.T) {
+	message := "GET /v1/apps is deprecated"
+	sut := NewRouter(nil).AddRoutes(models.Routes{
+		{
+			Path:   "/v1/apps",
+			Method: http.MethodGet,
+			HandlerFunc: func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+				httpUtils.AddWarning(r.Context(), message)
+				_ = httpUtils.StringResponse(w, r, "ok")
+			},
+			Deprecation: &models.Deprecation{Message: message},
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/apps", nil)
+	req.Header.Set("Authorization", "Bearer any-token")
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, req)
+	assert.Equal(t, []string{`299 - "GET /v1/apps is deprecated"`}, w.Header().Values("Warning"), "The deprecation warning is merged with the warnings of the handler")
+
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/apps", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, []string{`299 - "GET /v1/apps is deprecated"`}, w.Header().Values("Warning"), "Error responses get the deprecation warning")
+}
@@ -0,0 +1,211 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/equinor/radix-common/net/health"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultDrainPeriod     = 5 * time.Second
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+type namedServer struct {
+	name     string
+	server   *http.Server
+	listener net.Listener
+}
+
+// ServerRunner Runs HTTP servers, e.g. API, metrics and pprof, until the context is cancelled or a server fails.
+// On shutdown, readiness is marked false, the servers keep serving during the drain period so load balancers
+// can stop sending new requests, and the servers are then shut down with a deadline
+type ServerRunner struct {
+	servers         []namedServer
+	drainPeriod     time.Duration
+	shutdownTimeout time.Duration
+	health          *health.Registry
+}
+
+// ServerRunnerOption Option for the ServerRunner
+type ServerRunnerOption func(*ServerRunner)
+
+// WithServer Adds a server, listening on server.Addr. Servers with TLSConfig serve TLS with the certificates in the config
+func WithServer(name string, server *http.Server) ServerRunnerOption {
+	return func(runner *ServerRunner) {
+		runner.servers = append(runner.servers, namedServer{name: name, server: server})
+	}
+}
+
+// WithServerListener Adds a server, serving on the listener instead of listening on server.Addr
+func WithServerListener(name string, server *http.Server, listener net.Listener) ServerRunnerOption {
+	return func(runner *ServerRunner) {
+		runner.servers = append(runner.servers, namedServer{name: name, server: server, listener: listener})
+	}
+}
+
+// WithDrainPeriod Time the servers keep serving after readiness is marked false. Defaults to 5 seconds
+func WithDrainPeriod(period time.Duration) ServerRunnerOption {
+	return func(runner *ServerRunner) {
+		runner.drainPeriod = period
+	}
+}
+
+// WithShutdownTimeout Time allowed for in-flight requests to complete after the drain period. Defaults to 30 seconds.
+// Connections still open after the timeout are closed
+func WithShutdownTimeout(timeout time.Duration) ServerRunnerOption {
+	return func(runner *ServerRunner) {
+		runner.shutdownTimeout = timeout
+	}
+}
+
+// WithHealthRegistry Registry marked as stopping when shutdown starts, so the readiness probe fails
+func WithHealthRegistry(registry *health.Registry) ServerRunnerOption {
+	return func(runner *ServerRunner) {
+		runner.health = registry
+	}
+}
+
+// NewServerRunner Constructor for ServerRunner
+func NewServerRunner(options ...ServerRunnerOption) *ServerRunner {
+	runner := &ServerRunner{
+		drainPeriod:     defaultDrainPeriod,
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+	for _, option := range options {
+		option(runner)
+	}
+	return runner
+}
+
+// Run Starts the servers, and shuts them down when the context is cancelled or a server fails.
+// Phases are logged with the zerolog logger in the context.
+// Returns the errors of the servers and of the shutdown joined, or nil when all servers shut down cleanly
+func (runner *ServerRunner) Run(ctx context.Context) error {
+	logger := zerolog.Ctx(ctx)
+
+	servers, err := runner.listen()
+	if err != nil {
+		return err
+	}
+
+	serveErrs := make(chan error, len(servers))
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		logger.Info().Str("server", s.name).Str("addr", s.listener.Addr().String()).Msg("starting server")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := serve(s); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error().Err(err).Str("server", s.name).Msg("server failed")
+				serveErrs <- fmt.Errorf("%s server: %w", s.name, err)
+			}
+		}()
+	}
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+		logger.Info().Msg("shutdown requested")
+		if runner.health != nil {
+			runner.health.MarkStopping()
+		}
+		if runner.drainPeriod > 0 {
+			logger.Info().Dur("drain_period", runner.drainPeriod).Msg("draining requests")
+			timer := time.NewTimer(runner.drainPeriod)
+			select {
+			case <-timer.C:
+			case err := <-serveErrs:
+				timer.Stop()
+				errs = append(errs, err)
+			}
+		}
+	case err := <-serveErrs:
+		errs = append(errs, err)
+		if runner.health != nil {
+			runner.health.MarkStopping()
+		}
+	}
+
+	logger.Info().Dur("shutdown_timeout", runner.shutdownTimeout).Msg("shutting down servers")
+	errs = append(errs, runner.shutdown(servers)...)
+	wg.Wait()
+	close(serveErrs)
+	for err := range serveErrs {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		logger.Error().Err(err).Msg("servers stopped with errors")
+		return err
+	}
+	logger.Info().Msg("servers stopped")
+	return nil
+}
+
+// ListenAndServe Runs the servers until SIGINT or SIGTERM is received, see Run
+func (runner *ServerRunner) ListenAndServe(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return runner.Run(ctx)
+}
+
+// listen Listens on the address of servers without a listener. All listeners are closed if one of them fails
+func (runner *ServerRunner) listen() ([]namedServer, error) {
+	servers := make([]namedServer, 0, len(runner.servers))
+	for _, s := range runner.servers {
+		if s.listener == nil {
+			addr := s.server.Addr
+			if len(addr) == 0 {
+				addr = ":http"
+			}
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				for _, started := range servers {
+					_ = started.listener.Close()
+				}
+				return nil, fmt.Errorf("%s server: %w", s.name, err)
+			}
+			s.listener = listener
+		}
+		servers = append(servers, s)
+	}
+	return servers, nil
+}
+
+func (runner *ServerRunner) shutdown(servers []namedServer) []error {
+	ctx, cancel := context.WithTimeout(context.Background(), runner.shutdownTimeout)
+	defer cancel()
+
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.server.Shutdown(ctx); err != nil {
+				_ = s.server.Close()
+				errs[i] = fmt.Errorf("%s server shutdown: %w", s.name, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func serve(s namedServer) error {
+	if s.server.TLSConfig != nil {
+		return s.server.ServeTLS(s.listener, "", "")
+	}
+	return s.server.Serve(s.listener)
+}
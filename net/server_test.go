@@ -0,0 +1,126 @@
+package net
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/net/health"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestListener(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return listener
+}
+
+func getBody(t *testing.T, url string) string {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func Test_ServerRunner_GracefulShutdown(t *testing.T) {
+	registry := health.NewRegistry()
+	registry.MarkStarted()
+	apiListener, metricsListener := newTestListener(t), newTestListener(t)
+	inFlight, release := make(chan struct{}), make(chan struct{})
+	api := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/in-flight" {
+			close(inFlight)
+			<-release
+		}
+		_, _ = w.Write([]byte("api"))
+	})}
+	metrics := &http.Server{Handler: registry.Handler()}
+	sut := NewServerRunner(
+		WithServerListener("api", api, apiListener),
+		WithServerListener("metrics", metrics, metricsListener),
+		WithHealthRegistry(registry),
+		WithDrainPeriod(time.Second),
+		WithShutdownTimeout(time.Second),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- sut.Run(ctx) }()
+
+	apiURL := "http://" + apiListener.Addr().String()
+	readyURL := "http://" + metricsListener.Addr().String() + "/readyz"
+	assert.Equal(t, "api", getBody(t, apiURL))
+	assert.JSONEq(t, `{"status":"ok"}`, getBody(t, readyURL))
+	inFlightResult := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(apiURL + "/in-flight")
+		if err == nil {
+			err = resp.Body.Close()
+		}
+		inFlightResult <- err
+	}()
+	<-inFlight
+
+	cancel()
+	require.Eventually(t, registry.Stopping, time.Second, time.Millisecond, "The service is marked stopping when the context is cancelled")
+	assert.JSONEq(t, `{"status":"stopping"}`, getBody(t, readyURL), "Readiness fails while draining")
+	assert.Equal(t, "api", getBody(t, apiURL), "Requests are served while draining")
+	close(release)
+	assert.NoError(t, <-inFlightResult, "In-flight requests complete")
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "servers did not shut down")
+	}
+	_, err := http.Get(apiURL)
+	assert.Error(t, err, "Servers are stopped")
+}
+
+func Test_ServerRunner_ListenError(t *testing.T) {
+	listener := newTestListener(t)
+	defer listener.Close()
+
+	err := NewServerRunner(WithServer("api", &http.Server{Addr: listener.Addr().String()})).Run(context.Background())
+	assert.ErrorContains(t, err, "api server: ")
+}
+
+func Test_ServerRunner_CombinesErrors(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	t.Cleanup(func() { close(release) })
+	listener := newTestListener(t)
+	api := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})}
+	failing := &http.Server{}
+	failingListener := newTestListener(t)
+	sut := NewServerRunner(
+		WithServerListener("api", api, listener),
+		WithServerListener("pprof", failing, failingListener),
+		WithDrainPeriod(time.Minute),
+		WithShutdownTimeout(10*time.Millisecond),
+	)
+
+	result := make(chan error, 1)
+	go func() { result <- sut.Run(context.Background()) }()
+	go func() { _, _ = http.Get("http://" + listener.Addr().String()) }()
+	<-started
+	_ = failingListener.Close()
+
+	select {
+	case err := <-result:
+		assert.ErrorContains(t, err, "pprof server: ")
+		assert.ErrorContains(t, err, "api server shutdown: ")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(2 * time.Second):
+		require.Fail(t, "servers did not shut down")
+	}
+}
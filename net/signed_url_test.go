@@ -0,0 +1,108 @@
+package net
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/equinor/radix-common/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RadixMiddleware_SignedURL(t *testing.T) {
+	clock := utils.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	oldKey, err := NewSigningKey("old")
+	require.NoError(t, err)
+	currentKey, err := NewSigningKey("current")
+	require.NoError(t, err)
+	signer := NewURLSigner([]SigningKey{oldKey}, WithURLSignerClock(clock))
+
+	handler := func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+		_ = httpUtils.StringResponse(w, r, accounts.GetPrincipal())
+	}
+	sut := NewRouter(nil, WithURLSigner(signer)).AddRoutes(models.Routes{
+		{Path: "/apps/{app}/logs", Method: http.MethodGet, SignedURL: true, HandlerFunc: handler},
+		{Path: "/apps/{app}", Method: http.MethodGet, HandlerFunc: handler},
+	})
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		sut.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	signed, err := signer.Sign(http.MethodGet, "https://api.radix.equinor.com/apps/app1/logs?lines=100", "user@equinor.com", time.Minute)
+	require.NoError(t, err)
+	assert.NotContains(t, signed, "token=")
+
+	w := serve(http.MethodGet, signed)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user@equinor.com", w.Body.String())
+
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, strings.Replace(signed, "/app1/", "/app2/", 1)).Code, "Path is signed")
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, strings.Replace(signed, "lines=100", "lines=1000", 1)).Code, "Query is signed")
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, strings.Replace(signed, "radix-principal=user", "radix-principal=admin", 1)).Code, "Principal is signed")
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, strings.Replace(signed, "/logs", "", 1)).Code, "Signed URLs are only accepted by routes allowing them")
+
+	sut.AddRoutes(models.Routes{{Path: "/apps/{app}/logs", Method: http.MethodPost, SignedURL: true, HandlerFunc: handler}})
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodPost, signed).Code, "Method is signed")
+
+	require.NoError(t, signer.SetKeys(currentKey, oldKey))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, signed).Code, "URLs signed with the previous key are valid after rotation")
+	rotated, err := signer.Sign(http.MethodGet, "/apps/app1/logs", "user@equinor.com", time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, rotated, "radix-key=current")
+	require.NoError(t, signer.SetKeys(currentKey))
+	assert.Equal(t, http.StatusUnauthorized, serve(http.MethodGet, signed).Code, "URLs signed with a removed key are invalid")
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, rotated).Code)
+
+	clock.Advance(time.Minute)
+	w = serve(http.MethodGet, rotated)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "The signed URL expired")
+}
+
+func Test_URLSigner_RejectsInvalidKeys(t *testing.T) {
+	key, err := NewSigningKey("any")
+	require.NoError(t, err)
+	invalidKeys := map[string][]SigningKey{
+		"empty secret": {{ID: "any"}},
+		"short secret": {{ID: "any", Secret: []byte("short")}},
+		"empty id":     {{Secret: key.Secret}},
+		"duplicate id": {key, key},
+	}
+	for name, keys := range invalidKeys {
+		t.Run(name, func(t *testing.T) {
+			assert.Panics(t, func() { NewURLSigner(keys) })
+			signer := NewURLSigner([]SigningKey{key})
+			assert.Error(t, signer.SetKeys(keys...))
+			signed, err := signer.Sign(http.MethodGet, "/any", "user@equinor.com", time.Minute)
+			require.NoError(t, err)
+			assert.Contains(t, signed, "radix-key=any", "The current keys are kept")
+		})
+	}
+}
+
+func Test_URLSigner_RejectsEmptyPrincipal(t *testing.T) {
+	key, err := NewSigningKey("any")
+	require.NoError(t, err)
+	signer := NewURLSigner([]SigningKey{key})
+
+	_, err = signer.Sign(http.MethodGet, "/any", "", time.Minute)
+	assert.Error(t, err, "URLs are not signed without a principal")
+
+	query := url.Values{}
+	query.Set(signedURLExpiresParam, strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+	query.Set(signedURLPrincipalParam, "")
+	query.Set(signedURLKeyParam, key.ID)
+	query.Set(signedURLSignatureParam, signature(key, http.MethodGet, "/any", query))
+	_, signed, err := signer.Verify(httptest.NewRequest(http.MethodGet, "/any?"+query.Encode(), nil))
+	assert.True(t, signed)
+	assert.ErrorIs(t, err, ErrSignedURLInvalid, "A validly signed URL without a principal is rejected")
+}
@@ -0,0 +1,193 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/rs/zerolog"
+)
+
+// HandlerPanic A panic recovered in the handler goroutine of RunWithTimeout, re-raised in the calling goroutine
+// with the stack of the handler. HandlePanic logs the value with this stack
+type HandlerPanic struct {
+	// Value The value passed to panic by the handler
+	Value any
+	// Stack The stack of the handler goroutine when it panicked
+	Stack []byte
+}
+
+// String The panic value and the stack of the handler
+func (p *HandlerPanic) String() string {
+	return fmt.Sprintf("%v\n\n%s", p.Value, p.Stack)
+}
+
+// Timeout Wraps a http.Handler with a timeout, see RunWithTimeout
+func Timeout(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RunWithTimeout(w, r, timeout, next.ServeHTTP)
+	})
+}
+
+// RunWithTimeout Runs the handler with a deadline on the request context.
+// The response is buffered, and when the handler overruns the timeout, 504 Gateway Timeout is answered,
+// and further writes from the handler fail with http.ErrHandlerTimeout.
+// RunWithTimeout returns at the timeout while the handler may still run, so the returned channel is closed when the handler returns,
+// e.g. to hold a concurrency limiter slot until the work is done.
+// Panics in the handler are re-raised in the calling goroutine as *HandlerPanic, except http.ErrAbortHandler which is re-raised as is.
+// Panics after the timeout are logged with the stack to the zerolog logger in the request context.
+// Streaming handlers must not run with a timeout, since the response is not flushed before the handler completes
+func RunWithTimeout(w http.ResponseWriter, r *http.Request, timeout time.Duration, handler func(http.ResponseWriter, *http.Request)) <-chan struct{} {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	// The handler sees the headers already set on w, e.g. CORS and rate limit headers, and they are kept unless the handler removes them
+	tw := &timeoutWriter{ctx: ctx, header: w.Header().Clone()}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	panicChan := make(chan any, 1)
+	go func() {
+		defer close(exited)
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered != http.ErrAbortHandler {
+					recovered = &HandlerPanic{Value: recovered, Stack: debug.Stack()}
+				}
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				// The caller has answered 504 and returned, so the panic can only be logged
+				if tw.timedOut {
+					logPanicAfterTimeout(r, recovered)
+					return
+				}
+				panicChan <- recovered
+			}
+		}()
+		handler(tw, r)
+		close(done)
+	}()
+
+	select {
+	case recovered := <-panicChan:
+		panic(recovered)
+	case <-done:
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		// The handler gave up on the cancelled context, by a rejected write or without writing a response
+		if tw.timedOut || (tw.code == 0 && ctx.Err() != nil) {
+			tw.timedOut = true
+			writeTimeoutResponse(w, r, ctx)
+			return exited
+		}
+		header := w.Header()
+		for key := range header {
+			if _, ok := tw.header[key]; !ok {
+				delete(header, key)
+			}
+		}
+		for key, values := range tw.header {
+			header[key] = values
+		}
+		if recorder, ok := w.(httpUtils.ErrorTypeRecorder); ok && len(tw.errorType) > 0 {
+			recorder.RecordErrorType(tw.errorType)
+		}
+		if tw.code != 0 {
+			w.WriteHeader(tw.code)
+		}
+		_, _ = w.Write(tw.body.Bytes())
+	case <-ctx.Done():
+		tw.mu.Lock()
+		defer tw.mu.Unlock()
+		// The handler panicked before the timeout was observed
+		select {
+		case recovered := <-panicChan:
+			panic(recovered)
+		default:
+		}
+		tw.timedOut = true
+		writeTimeoutResponse(w, r, ctx)
+	}
+	return exited
+}
+
+// logPanicAfterTimeout Logs a panic in a handler that overran the timeout, like HandlePanic
+func logPanicAfterTimeout(r *http.Request, recovered any) {
+	handlerPanic, ok := recovered.(*HandlerPanic)
+	if !ok {
+		return
+	}
+	zerolog.Ctx(r.Context()).Error().
+		Interface("panic", handlerPanic.Value).
+		Str("stack", string(handlerPanic.Stack)).
+		Msg("recovered from panic after timeout")
+}
+
+func writeTimeoutResponse(w http.ResponseWriter, r *http.Request, ctx context.Context) {
+	if err := httpUtils.ErrorResponse(w, r, timeoutError(ctx)); err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("unable to write timeout error response")
+	}
+}
+
+func timeoutError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return httpUtils.GatewayTimeoutError("The request timed out")
+	}
+	return ctx.Err()
+}
+
+// timeoutWriter Buffers the response until the handler completes, and rejects writes after the timeout.
+// Writes are rejected as soon as the context is done, so a handler woken by the cancelled context can not write a response
+type timeoutWriter struct {
+	ctx       context.Context
+	mu        sync.Mutex
+	header    http.Header
+	body      bytes.Buffer
+	code      int
+	timedOut  bool
+	errorType httpUtils.Type
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.isTimedOut() {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.body.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.isTimedOut() || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
+
+func (tw *timeoutWriter) RecordErrorType(errorType httpUtils.Type) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.errorType = errorType
+}
+
+// isTimedOut Marks the writer as timed out when the context is done. Must be called with the lock held
+func (tw *timeoutWriter) isTimedOut() bool {
+	if !tw.timedOut && tw.ctx.Err() != nil {
+		tw.timedOut = true
+	}
+	return tw.timedOut
+}
@@ -0,0 +1,197 @@
+package net
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RunWithTimeout_CompletesInTime(t *testing.T) {
+	w := httptest.NewRecorder()
+	RunWithTimeout(w, httptest.NewRequest(http.MethodGet, "/any", nil), time.Second, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Any", "any")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	})
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "any", w.Header().Get("X-Any"))
+	assert.Equal(t, "created", w.Body.String())
+}
+
+func Test_RunWithTimeout_Overruns(t *testing.T) {
+	writeErr := make(chan error, 1)
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	RunWithTimeout(w, req, 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		_, err := w.Write([]byte("too late"))
+		writeErr <- err
+	})
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.JSONEq(t, `{"type":"timeout","message":"The request timed out"}`, w.Body.String())
+	assert.ErrorIs(t, <-writeErr, http.ErrHandlerTimeout)
+	assert.NotContains(t, w.Body.String(), "too late")
+}
+
+func Test_RunWithTimeout_KeepsOuterHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Add("Vary", "Origin")
+	w.Header().Set("RateLimit-Remaining", "9")
+	w.Header().Set("X-Removed", "any")
+	RunWithTimeout(w, httptest.NewRequest(http.MethodGet, "/any", nil), time.Second, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		w.Header().Del("X-Removed")
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	assert.Equal(t, []string{"Origin", "Accept"}, w.Header().Values("Vary"))
+	assert.Equal(t, "9", w.Header().Get("RateLimit-Remaining"))
+	assert.Empty(t, w.Header().Get("X-Removed"))
+}
+
+func panickingHandler(http.ResponseWriter, *http.Request) {
+	panic("any panic")
+}
+
+func Test_RunWithTimeout_ReraisesPanic(t *testing.T) {
+	recovered := func() (recovered any) {
+		defer func() { recovered = recover() }()
+		RunWithTimeout(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/any", nil), time.Second, panickingHandler)
+		return nil
+	}()
+
+	handlerPanic, ok := recovered.(*HandlerPanic)
+	require.True(t, ok)
+	assert.Equal(t, "any panic", handlerPanic.Value)
+	assert.Contains(t, string(handlerPanic.Stack), "panickingHandler", "The stack of the handler goroutine is kept")
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		RunWithTimeout(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/any", nil), time.Second, func(http.ResponseWriter, *http.Request) {
+			panic(http.ErrAbortHandler)
+		})
+	})
+}
+
+func Test_RunWithTimeout_LogsPanicAfterTimeout(t *testing.T) {
+	var logOutput bytes.Buffer
+	logger := zerolog.New(&logOutput)
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req = req.WithContext(logger.WithContext(req.Context()))
+	w := httptest.NewRecorder()
+	returned := make(chan struct{})
+	exited := RunWithTimeout(w, req, 10*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		<-returned
+		panickingHandler(w, r)
+	})
+	close(returned)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		require.Fail(t, "the handler did not return")
+	}
+	assert.Contains(t, logOutput.String(), `"panic":"any panic"`)
+	assert.Contains(t, logOutput.String(), "panickingHandler", "The stack of the handler goroutine is logged")
+}
+
+func Test_RadixMiddleware_TimeoutSeenByMiddlewares(t *testing.T) {
+	events := make(chan AuditEvent, 10)
+	auditor := NewAuditor(auditSinkFunc(func(event AuditEvent) error {
+		events <- event
+		return nil
+	}))
+	store := NewMemoryIdempotencyStore()
+	var calls atomic.Int32
+	handlerDone := make(chan struct{})
+	handler := func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			defer close(handlerDone)
+			<-r.Context().Done()
+		}
+		w.WriteHeader(http.StatusCreated)
+	}
+	sut := NewRouter(nil, WithTimeout(10*time.Millisecond), WithMiddlewares(auditor.Middleware(), NewIdempotency(store).Middleware())).AddRoutes(models.Routes{
+		{Path: "/jobs", Method: http.MethodPost, HandlerFunc: handler},
+	})
+
+	w := httptest.NewRecorder()
+	sut.ServeHTTP(w, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	<-handlerDone
+	assert.Equal(t, 0, store.Len(), "The key is released when the handler overruns")
+
+	w = httptest.NewRecorder()
+	sut.ServeHTTP(w, newIdempotencyTestRequest(t, "user1@equinor.com", "key1", "payload"))
+	assert.Equal(t, http.StatusCreated, w.Code, "The retry runs the handler")
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int32(2), calls.Load())
+
+	auditor.Close()
+	assert.Equal(t, http.StatusGatewayTimeout, (<-events).Status, "The audit event has the status answered to the client")
+	assert.Equal(t, http.StatusCreated, (<-events).Status)
+}
+
+func Test_RadixMiddleware_TimeoutHoldsConcurrencySlot(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, 0, 0)
+	unblock := make(chan struct{})
+	handler := func(models.Accounts, http.ResponseWriter, *http.Request) { <-unblock }
+	route := models.Route{Path: "/any", Authentication: models.AuthenticationAnonymous, HandlerFunc: handler}
+	sut := NewRadixMiddlewareForRoute(route, nil, WithTimeout(10*time.Millisecond), WithConcurrencyLimiter(limiter))
+
+	w := httptest.NewRecorder()
+	sut.Handle(w, httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Equal(t, 1, limiter.InFlight(), "The slot is held while the handler runs")
+
+	w = httptest.NewRecorder()
+	sut.Handle(w, httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	close(unblock)
+	assert.Eventually(t, func() bool { return limiter.InFlight() == 0 }, time.Second, time.Millisecond, "The slot is released when the handler returns")
+}
+
+func Test_RadixMiddleware_Timeout(t *testing.T) {
+	slowHandler := func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(50 * time.Millisecond):
+			_ = httpUtils.StringResponse(w, r, "done")
+		}
+	}
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/any", nil)
+		req.Header.Set("Authorization", "Bearer any-token")
+		return req
+	}
+	options := []RadixMiddlewareOption{WithTimeout(10 * time.Millisecond)}
+
+	w := httptest.NewRecorder()
+	NewRadixMiddlewareForRoute(models.Route{Path: "/any", HandlerFunc: slowHandler}, nil, options...).Handle(w, newRequest())
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+
+	w = httptest.NewRecorder()
+	NewRadixMiddlewareForRoute(models.Route{Path: "/any", Streaming: true, HandlerFunc: slowHandler}, nil, options...).Handle(w, newRequest())
+	assert.Equal(t, http.StatusOK, w.Code, "Streaming routes are not limited by the default timeout")
+
+	w = httptest.NewRecorder()
+	NewRadixMiddlewareForRoute(models.Route{Path: "/any", Timeout: -1, HandlerFunc: slowHandler}, nil, options...).Handle(w, newRequest())
+	assert.Equal(t, http.StatusOK, w.Code, "Routes can opt out of the timeout")
+
+	w = httptest.NewRecorder()
+	NewRadixMiddlewareForRoute(models.Route{Path: "/any", Timeout: time.Second, HandlerFunc: slowHandler}, nil, options...).Handle(w, newRequest())
+	assert.Equal(t, http.StatusOK, w.Code, "Route timeout replaces the default timeout")
+}
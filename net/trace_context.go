@@ -0,0 +1,161 @@
+package net
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	traceParentHeader = "traceparent"
+	traceStateHeader  = "tracestate"
+	requestIdHeader   = "X-Request-Id"
+	maxRequestIdSize  = 128
+)
+
+type traceContextKey struct{}
+
+// TraceContext W3C trace context of a request, see https://www.w3.org/TR/trace-context/
+type TraceContext struct {
+	// TraceID 32 lowercase hex characters identifying the trace
+	TraceID string
+	// SpanID 16 lowercase hex characters identifying the span of this request
+	SpanID string
+	// ParentSpanID Span id from the incoming traceparent header, or empty when this request starts the trace
+	ParentSpanID string
+	// Flags Trace flags as 2 lowercase hex characters, 01 when sampled
+	Flags string
+	// TraceState Vendor-specific trace state from the incoming tracestate header
+	TraceState string
+	// RequestID Correlation id from the incoming X-Request-Id header, or a new id
+	RequestID string
+}
+
+// TraceParent Value of the traceparent header, with the span of this request as parent
+func (tc TraceContext) TraceParent() string {
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + tc.Flags
+}
+
+// NewTraceContext Creates a trace context for the request, as a child span of the incoming traceparent header.
+// A new trace is started when the request has no valid traceparent header
+func NewTraceContext(r *http.Request) TraceContext {
+	tc := TraceContext{SpanID: randomHex(8), Flags: "00"}
+
+	if traceID, parentSpanID, flags, ok := parseTraceParent(r.Header.Get(traceParentHeader)); ok {
+		tc.TraceID, tc.ParentSpanID, tc.Flags = traceID, parentSpanID, flags
+		tc.TraceState = strings.Join(r.Header.Values(traceStateHeader), ",")
+	} else {
+		tc.TraceID = randomHex(16)
+	}
+
+	if requestId := r.Header.Get(requestIdHeader); len(requestId) > 0 && len(requestId) <= maxRequestIdSize && isPrintableASCII(requestId) {
+		tc.RequestID = requestId
+	} else {
+		tc.RequestID = xid.New().String()
+	}
+	return tc
+}
+
+// ContextWithTraceContext Returns a copy of the context with the trace context
+func ContextWithTraceContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceContextFromContext Returns the trace context stored in the context
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// StartTraceContext Creates a trace context for the request, and returns a shallow copy of the request with
+// the trace context and a zerolog logger with trace_id, span_id and request_id fields in the request context.
+// The request id is returned to the caller in the X-Request-Id response header
+func StartTraceContext(w http.ResponseWriter, r *http.Request) *http.Request {
+	tc := NewTraceContext(r)
+	w.Header().Set(requestIdHeader, tc.RequestID)
+
+	logger := zerolog.Ctx(r.Context()).With().
+		Str("trace_id", tc.TraceID).
+		Str("span_id", tc.SpanID).
+		Str("request_id", tc.RequestID).
+		Logger()
+	ctx := logger.WithContext(ContextWithTraceContext(r.Context(), tc))
+	return r.WithContext(ctx)
+}
+
+// TraceContextHandler Wraps a http.Handler, starting a trace context for each request, see StartTraceContext
+func TraceContextHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, StartTraceContext(w, r))
+	})
+}
+
+// InjectTraceContext Sets the traceparent, tracestate and X-Request-Id headers of an outgoing request
+// from the trace context in ctx. The headers are not changed when ctx has no trace context
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok {
+		return
+	}
+	header.Set(traceParentHeader, tc.TraceParent())
+	if len(tc.TraceState) > 0 {
+		header.Set(traceStateHeader, tc.TraceState)
+	} else {
+		header.Del(traceStateHeader)
+	}
+	header.Set(requestIdHeader, tc.RequestID)
+}
+
+// parseTraceParent Parses a version 00 traceparent header, or a header of a later version as described in the specification
+func parseTraceParent(value string) (traceID, parentSpanID, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 {
+		return "", "", "", false
+	}
+	version, traceID, parentSpanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" || (version == "00" && len(parts) != 4) {
+		return "", "", "", false
+	}
+	if !isLowerHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return "", "", "", false
+	}
+	if !isLowerHex(parentSpanID, 16) || parentSpanID == strings.Repeat("0", 16) {
+		return "", "", "", false
+	}
+	if !isLowerHex(flags, 2) {
+		return "", "", "", false
+	}
+	return traceID, parentSpanID, flags, true
+}
+
+func isLowerHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	for _, c := range value {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isPrintableASCII(value string) bool {
+	for _, c := range value {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func randomHex(size int) string {
+	b := make([]byte, size)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
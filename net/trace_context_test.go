@@ -0,0 +1,96 @@
+package net
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/equinor/radix-common/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewTraceContext_ContinuesIncomingTrace(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+	req.Header.Set("X-Request-Id", "any-request-id")
+
+	sut := NewTraceContext(req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sut.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", sut.ParentSpanID)
+	assert.Len(t, sut.SpanID, 16)
+	assert.NotEqual(t, sut.ParentSpanID, sut.SpanID)
+	assert.Equal(t, "01", sut.Flags)
+	assert.Equal(t, "congo=t61rcWkgMzE", sut.TraceState)
+	assert.Equal(t, "any-request-id", sut.RequestID)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+sut.SpanID+"-01", sut.TraceParent())
+}
+
+func Test_NewTraceContext_StartsNewTrace(t *testing.T) {
+	invalidTraceParents := []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, traceParent := range invalidTraceParents {
+		req := httptest.NewRequest(http.MethodGet, "/any", nil)
+		req.Header.Set("traceparent", traceParent)
+		req.Header.Set("tracestate", "congo=t61rcWkgMzE")
+
+		sut := NewTraceContext(req)
+
+		assert.Len(t, sut.TraceID, 32, traceParent)
+		assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", sut.TraceID, traceParent)
+		assert.Empty(t, sut.ParentSpanID, traceParent)
+		assert.Empty(t, sut.TraceState, traceParent)
+		assert.NotEmpty(t, sut.RequestID, traceParent)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req.Header.Set("traceparent", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", NewTraceContext(req).TraceID, "Later versions can have more fields")
+}
+
+func Test_InjectTraceContext(t *testing.T) {
+	tc := TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: "01", TraceState: "congo=t61rcWkgMzE", RequestID: "any-request-id"}
+	outgoing, _ := http.NewRequestWithContext(ContextWithTraceContext(t.Context(), tc), http.MethodGet, "http://any", nil)
+
+	InjectTraceContext(outgoing.Context(), outgoing.Header)
+
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", outgoing.Header.Get("traceparent"))
+	assert.Equal(t, "congo=t61rcWkgMzE", outgoing.Header.Get("tracestate"))
+	assert.Equal(t, "any-request-id", outgoing.Header.Get("X-Request-Id"))
+}
+
+func Test_RadixMiddleware_TraceContext(t *testing.T) {
+	var logOutput bytes.Buffer
+	logger := zerolog.New(&logOutput)
+	var actual TraceContext
+	route := models.Route{
+		Path:           "/any",
+		Authentication: models.AuthenticationAnonymous,
+		HandlerFunc: func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+			actual, _ = TraceContextFromContext(r.Context())
+			zerolog.Ctx(r.Context()).Info().Msg("any")
+		},
+	}
+	sut := NewRadixMiddlewareForRoute(route, nil, WithTraceContext())
+
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req = req.WithContext(logger.WithContext(req.Context()))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	sut.Handle(w, req)
+
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", actual.TraceID)
+	assert.Contains(t, logOutput.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+	assert.Contains(t, logOutput.String(), `"span_id":"`+actual.SpanID+`"`)
+	assert.Equal(t, actual.RequestID, w.Header().Get("X-Request-Id"))
+}
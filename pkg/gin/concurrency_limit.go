@@ -0,0 +1,22 @@
+package gin
+
+import (
+	radixnet "github.com/equinor/radix-common/net"
+	"github.com/gin-gonic/gin"
+)
+
+// ConcurrencyLimit limits the number of requests in flight.
+// Requests without a free slot within the queue timeout are aborted with 503 Service Unavailable
+func ConcurrencyLimit(limiter *radixnet.ConcurrencyLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		release, err := limiter.Enter(c.Writer, c.Request)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			writeErrors(c)
+			return
+		}
+		defer release()
+		c.Next()
+	}
+}
@@ -0,0 +1,51 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	radixnet "github.com/equinor/radix-common/net"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ConcurrencyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := radixnet.NewConcurrencyLimiter(1, 0, 10*time.Millisecond)
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	engine := gin.New()
+	engine.Use(ConcurrencyLimit(limiter))
+	engine.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		<-unblock
+		c.Status(http.StatusOK)
+	})
+	engine.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	slow := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+		slow <- w.Code
+	}()
+	<-entered
+	assert.Equal(t, 1, limiter.InFlight())
+
+	req := httptest.NewRequest(http.MethodGet, "/fast", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "Requests without a free slot are shed")
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"type"`)
+
+	close(unblock)
+	assert.Equal(t, http.StatusOK, <-slow)
+	assert.Equal(t, 0, limiter.InFlight(), "The slot is released when the request completes")
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
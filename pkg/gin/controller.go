@@ -0,0 +1,108 @@
+package gin
+
+import (
+	"strings"
+
+	"github.com/equinor/radix-common/models"
+	radixnet "github.com/equinor/radix-common/net"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// RegisterControllers registers the routes of the controllers on the gin router or route group.
+// Each route is wrapped in RadixMiddleware, so Accounts are built with the same rules as for net/http routers
+func RegisterControllers(router gin.IRouter, controllers []models.Controller, options ...radixnet.RadixMiddlewareOption) {
+	for _, controller := range controllers {
+		RegisterRoutes(router, models.ControllerRoutes(controller), options...)
+	}
+}
+
+// RegisterRoutes registers the routes on the gin router or route group.
+// Route paths use http.ServeMux patterns, e.g. /applications/{appName}, which are converted to gin paths.
+// The base path of the route group is prepended to the route path seen by RadixMiddleware, e.g. in metrics and audit events
+func RegisterRoutes(router gin.IRouter, routes models.Routes, options ...radixnet.RadixMiddlewareOption) {
+	for _, route := range routes {
+		path := ginPath(route.Path)
+		mounted := route
+		mounted.Path = mountedPath(router, route.Path)
+		handler := RadixHandler(mounted, options...)
+		if len(route.Method) == 0 {
+			router.Any(path, handler)
+		} else {
+			router.Handle(strings.ToUpper(route.Method), path, handler)
+		}
+	}
+}
+
+// RadixHandler adapts the route handler to a gin handler.
+// Gin path params are available to the handler with r.PathValue or net/http.GetPathParam,
+// and r.Pattern is set to the route pattern like http.ServeMux does.
+// The route path should be the full path the handler is mounted on, including the base path of the route group.
+// Access-Control-Allow-Origin: * is not set on responses, use CORS or radixnet.WithCORSPolicy to allow cross-origin requests.
+// Errors in c.Errors are not rendered, use ErrorResponder for that
+func RadixHandler(route models.Route, options ...radixnet.RadixMiddlewareOption) gin.HandlerFunc {
+	options = append([]radixnet.RadixMiddlewareOption{radixnet.WithoutDefaultCORSHeader()}, options...)
+	middleware := radixnet.NewRadixMiddlewareForRoute(route, nil, options...)
+	pattern := route.Path
+	if len(route.Method) > 0 {
+		pattern = strings.ToUpper(route.Method) + " " + route.Path
+	}
+	return func(c *gin.Context) {
+		c.Request.Pattern = pattern
+		for _, param := range c.Params {
+			c.Request.SetPathValue(param.Key, strings.TrimPrefix(param.Value, "/"))
+		}
+		middleware.Handle(c.Writer, c.Request)
+	}
+}
+
+// ErrorResponder renders the last error in c.Errors through net/http.ErrorResponse, when nothing is written to the response
+func ErrorResponder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		writeErrors(c)
+	}
+}
+
+func writeErrors(c *gin.Context) {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+	if err := httpUtils.ErrorResponse(c.Writer, c.Request, c.Errors.Last().Err); err != nil {
+		zerolog.Ctx(c.Request.Context()).Error().Err(err).Msg("unable to write error response")
+	}
+}
+
+// mountedPath prepends the base path of the route group to the path
+func mountedPath(router gin.IRouter, path string) string {
+	group, ok := router.(interface{ BasePath() string })
+	if !ok {
+		return path
+	}
+	base := strings.TrimSuffix(group.BasePath(), "/")
+	if len(base) == 0 {
+		return path
+	}
+	return base + "/" + strings.TrimPrefix(path, "/")
+}
+
+// ginPath converts a http.ServeMux pattern path to a gin path
+func ginPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}")
+		switch {
+		case name == "$":
+			segments[i] = ""
+		case strings.HasSuffix(name, "..."):
+			segments[i] = "*" + strings.TrimSuffix(name, "...")
+		default:
+			segments[i] = ":" + name
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,88 @@
+package gin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/equinor/radix-common/models"
+	radixnet "github.com/equinor/radix-common/net"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testController struct {
+	routes models.Routes
+}
+
+func (c testController) GetRoutes() models.Routes {
+	return c.routes
+}
+
+func Test_RegisterControllers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var actualAppName, actualFile, actualPattern string
+	controller := testController{routes: models.Routes{
+		{
+			Path:   "/applications/{appName}/files/{file...}",
+			Method: http.MethodGet,
+			HandlerFunc: func(accounts models.Accounts, w http.ResponseWriter, r *http.Request) {
+				actualAppName, _ = httpUtils.GetPathParam[string](r, "appName")
+				actualFile = r.PathValue("file")
+				actualPattern = r.Pattern
+				_ = httpUtils.StringResponse(w, r, accounts.GetToken())
+			},
+		},
+	}}
+	engine := gin.New()
+	metrics := radixnet.NewMetrics()
+	RegisterControllers(engine.Group("/api/v1"), []models.Controller{controller}, radixnet.WithMetrics(metrics))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/applications/any-app/files/dir/file.txt", nil)
+	req.Header.Set("Authorization", "Bearer any-token")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "any-token", w.Body.String())
+	assert.Equal(t, "any-app", actualAppName)
+	assert.Equal(t, "dir/file.txt", actualFile)
+	assert.Equal(t, "GET /api/v1/applications/{appName}/files/{file...}", actualPattern, "Pattern includes the base path of the route group")
+	var exposition strings.Builder
+	require.NoError(t, metrics.Write(&exposition))
+	assert.Contains(t, exposition.String(), `route="/api/v1/applications/{appName}/files/{file...}"`)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/applications/any-app/files/file.txt", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func Test_ErrorResponder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(ErrorResponder())
+	engine.GET("/any", func(c *gin.Context) {
+		_ = c.Error(httpUtils.NotFoundError("not found"))
+	})
+	engine.GET("/written", func(c *gin.Context) {
+		_ = c.Error(errors.New("any error"))
+		c.String(http.StatusOK, "ok")
+	})
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/written", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func Test_ginPath(t *testing.T) {
+	assert.Equal(t, "/applications/:appName/jobs/:jobName", ginPath("/applications/{appName}/jobs/{jobName}"))
+	assert.Equal(t, "/files/*path", ginPath("/files/{path...}"))
+	assert.Equal(t, "/applications/", ginPath("/applications/{$}"))
+}
@@ -0,0 +1,17 @@
+package gin
+
+import (
+	radixnet "github.com/equinor/radix-common/net"
+	"github.com/gin-gonic/gin"
+)
+
+// CORS applies the CORS policy to requests, and aborts preflight requests with 204 No Content
+func CORS(policy *radixnet.CORSPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy.Apply(c.Writer, c.Request) {
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,83 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/equinor/radix-common/models"
+	radixnet "github.com/equinor/radix-common/net"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newEngine := func(policy *radixnet.CORSPolicy) *gin.Engine {
+		engine := gin.New()
+		engine.Use(CORS(policy))
+		engine.GET("/applications", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+		return engine
+	}
+	newRequest := func(method string) *http.Request {
+		req := httptest.NewRequest(method, "/applications", nil)
+		req.Header.Set("Origin", "https://console.radix.equinor.com")
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		return req
+	}
+
+	engine := newEngine(&radixnet.CORSPolicy{AllowedOrigins: []string{"https://*.radix.equinor.com"}, AllowedMethods: []string{http.MethodGet}, AllowCredentials: true})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, newRequest(http.MethodOptions))
+	assert.Equal(t, http.StatusNoContent, w.Code, "Preflight requests are aborted")
+	assert.Equal(t, "https://console.radix.equinor.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Empty(t, w.Body.String())
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, newRequest(http.MethodGet))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+	assert.Equal(t, "https://console.radix.equinor.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+
+	engine = newEngine(&radixnet.CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true})
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, newRequest(http.MethodGet))
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"), "Credentials are never allowed for any origin")
+}
+
+func Test_CORS_RegisterControllers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	controller := testController{routes: models.Routes{
+		{
+			Path:           "/applications",
+			Method:         http.MethodGet,
+			Authentication: models.AuthenticationAnonymous,
+			HandlerFunc: func(_ models.Accounts, w http.ResponseWriter, r *http.Request) {
+				_ = httpUtils.StringResponse(w, r, "ok")
+			},
+		},
+	}}
+	engine := gin.New()
+	engine.Use(CORS(&radixnet.CORSPolicy{AllowedOrigins: []string{"https://*.radix.equinor.com"}, AllowCredentials: true}))
+	RegisterControllers(engine, []models.Controller{controller})
+
+	req := httptest.NewRequest(http.MethodGet, "/applications", nil)
+	req.Header.Set("Origin", "https://console.radix.equinor.com")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"https://console.radix.equinor.com"}, w.Header().Values("Access-Control-Allow-Origin"), "The route does not add Access-Control-Allow-Origin: *")
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+
+	engine = gin.New()
+	RegisterControllers(engine, []models.Controller{controller})
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Values("Access-Control-Allow-Origin"), "Cross-origin requests are not allowed without a CORS policy")
+}
@@ -0,0 +1,14 @@
+package gin
+
+import (
+	"github.com/equinor/radix-common/net/health"
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterHealthEndpoints registers /livez, /readyz, /startupz and the detailed report on /healthz on the gin router or route group
+func RegisterHealthEndpoints(router gin.IRouter, registry *health.Registry) {
+	router.GET("/livez", gin.WrapH(registry.LivenessHandler()))
+	router.GET("/readyz", gin.WrapH(registry.ReadinessHandler()))
+	router.GET("/startupz", gin.WrapH(registry.StartupHandler()))
+	router.GET("/healthz", gin.WrapH(registry.ReportHandler()))
+}
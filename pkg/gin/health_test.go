@@ -0,0 +1,50 @@
+package gin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/equinor/radix-common/net/health"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RegisterHealthEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := health.NewRegistry().Register(
+		health.Check{Name: "database", Critical: true, Check: func(context.Context) error { return nil }},
+		health.Check{Name: "cache", Check: func(context.Context) error { return errors.New("any error") }},
+	)
+	engine := gin.New()
+	RegisterHealthEndpoints(engine.Group("/health"), registry)
+	serve := func(path string) (int, health.Report) {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var report health.Report
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return w.Code, report
+	}
+
+	code, _ := serve("/health/livez")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = serve("/health/startupz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	code, _ = serve("/health/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code, "Not ready before initialization completes")
+
+	registry.MarkStarted()
+	code, _ = serve("/health/startupz")
+	assert.Equal(t, http.StatusOK, code)
+	code, report := serve("/health/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, health.StatusDegraded, report.Status)
+	assert.Empty(t, report.Checks)
+	code, report = serve("/health/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, report.Checks, 2, "The detailed report includes the checks")
+}
@@ -0,0 +1,64 @@
+package gin
+
+import (
+	"fmt"
+
+	"github.com/equinor/radix-common/models"
+	radixnet "github.com/equinor/radix-common/net"
+	httpUtils "github.com/equinor/radix-common/net/http"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitOption Option for RateLimit
+type RateLimitOption func(*rateLimitConfig)
+
+type rateLimitConfig struct {
+	verifyToken models.TokenVerifier
+}
+
+// WithRateLimitTokenVerifier Verifies the bearer token, e.g. with models.JWTTokenVerifier, so requests are limited per verified principal.
+// Without a verifier, or when the token is not valid, requests are limited per client IP
+func WithRateLimitTokenVerifier(verifier models.TokenVerifier) RateLimitOption {
+	return func(config *rateLimitConfig) {
+		config.verifyToken = verifier
+	}
+}
+
+// RateLimit limits the request rate per verified principal, see net.RateLimitKey, or per client IP for other requests.
+// The client IP is resolved by gin, so configure the trusted proxies of the engine with SetTrustedProxies,
+// like net.ClientIPResolver for net/http routers.
+// A non-nil limit replaces the default limit of the rate limiter, with buckets separate for each route.
+// Requests exceeding the limit are aborted with 429 Too Many Requests. Panics when the limit is not valid, see net.ValidateRateLimit
+func RateLimit(limiter *radixnet.RateLimiter, limit *models.RateLimit, options ...RateLimitOption) gin.HandlerFunc {
+	if limit != nil {
+		if err := radixnet.ValidateRateLimit(*limit); err != nil {
+			panic(fmt.Sprintf("rate limit: %v", err))
+		}
+	}
+	config := rateLimitConfig{}
+	for _, option := range options {
+		option(&config)
+	}
+
+	return func(c *gin.Context) {
+		token, _ := httpUtils.GetBearerTokenFromHeader(c.Request)
+		accounts := models.NewAccounts(token, models.Impersonation{})
+		if len(token) > 0 && config.verifyToken != nil {
+			if claims, err := config.verifyToken(c.Request.Context(), token); err == nil {
+				accounts = accounts.WithVerifiedClaims(claims)
+			}
+		}
+		key := radixnet.RateLimitKey(accounts, c.ClientIP())
+		if limit != nil {
+			key = radixnet.RouteRateLimitKey(key, c.Request.Method, c.FullPath())
+		}
+
+		if err := limiter.Allow(c.Writer, key, limit); err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			writeErrors(c)
+			return
+		}
+		c.Next()
+	}
+}
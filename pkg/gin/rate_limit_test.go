@@ -0,0 +1,71 @@
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/equinor/radix-common/models"
+	radixnet "github.com/equinor/radix-common/net"
+	"github.com/equinor/radix-common/utils"
+	"github.com/gin-gonic/gin"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestToken(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("any-key"))
+	require.NoError(t, err)
+	return token
+}
+
+func Test_RateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newEngine := func(options ...RateLimitOption) *gin.Engine {
+		clock := utils.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		limiter := radixnet.NewRateLimiter(models.RateLimit{RequestsPerSecond: 1, Burst: 1}, radixnet.NewMemoryRateLimitStore(time.Minute), clock)
+		engine := gin.New()
+		engine.Use(RateLimit(limiter, nil, options...))
+		engine.GET("/any", func(c *gin.Context) { c.Status(http.StatusOK) })
+		return engine
+	}
+	serve := func(engine *gin.Engine, upn string) int {
+		req := httptest.NewRequest(http.MethodGet, "/any", nil)
+		req.Header.Set("Authorization", "Bearer "+newTestToken(t, jwt.MapClaims{"upn": upn}))
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	engine := newEngine()
+	assert.Equal(t, http.StatusOK, serve(engine, "user1"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(engine, "user2"), "Unverified tokens are limited per client IP")
+
+	verifier := models.JWTTokenVerifier(func(*jwt.Token) (interface{}, error) { return []byte("any-key"), nil }, jwt.WithValidMethods([]string{"HS256"}))
+	engine = newEngine(WithRateLimitTokenVerifier(verifier))
+	assert.Equal(t, http.StatusOK, serve(engine, "user1"))
+	assert.Equal(t, http.StatusOK, serve(engine, "user2"), "Verified principals have their own bucket")
+	assert.Equal(t, http.StatusTooManyRequests, serve(engine, "user1"))
+}
+
+func Test_RateLimit_RouteLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	clock := utils.NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	limiter := radixnet.NewRateLimiter(models.RateLimit{RequestsPerSecond: 1, Burst: 10}, radixnet.NewMemoryRateLimitStore(time.Minute), clock)
+	limit := &models.RateLimit{RequestsPerSecond: 1, Burst: 1}
+	engine := gin.New()
+	engine.GET("/any", RateLimit(limiter, limit), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	route := models.Route{Path: "/any", Method: http.MethodGet, Authentication: models.AuthenticationAnonymous, RateLimit: limit, HandlerFunc: func(models.Accounts, http.ResponseWriter, *http.Request) {}}
+	w = httptest.NewRecorder()
+	radixnet.NewRadixMiddlewareForRoute(route, nil, radixnet.WithRateLimiter(limiter)).Handle(w, httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "The route bucket is shared with RadixMiddleware")
+
+	assert.Panics(t, func() { RateLimit(limiter, &models.RateLimit{RequestsPerSecond: 0, Burst: 1}) })
+}
@@ -0,0 +1,20 @@
+package gin
+
+import (
+	radixnet "github.com/equinor/radix-common/net"
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery recovers panics, logs them with the zerolog logger from the request context,
+// and answers with a server error through the standard error response. http.ErrAbortHandler is re-raised
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				c.Abort()
+				radixnet.HandlePanic(c.Writer, c.Request, recovered)
+			}
+		}()
+		c.Next()
+	}
+}
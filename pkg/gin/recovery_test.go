@@ -0,0 +1,44 @@
+package gin
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Recovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logOutput bytes.Buffer
+	engine := gin.New()
+	engine.Use(SetZerologLogger(func(context.Context) zerolog.Logger { return zerolog.New(&logOutput) }), Recovery())
+	engine.GET("/panic", func(*gin.Context) { panic("any panic") })
+	engine.GET("/written", func(c *gin.Context) {
+		c.String(http.StatusAccepted, "accepted")
+		panic("any panic")
+	})
+	engine.GET("/abort", func(*gin.Context) { panic(http.ErrAbortHandler) })
+
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"type":"server","message":"Internal server error"}`, w.Body.String())
+	assert.Contains(t, logOutput.String(), `"panic":"any panic"`)
+	assert.Contains(t, logOutput.String(), `"stack":`)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/written", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code, "The written response is kept")
+	assert.Equal(t, "accepted", w.Body.String())
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abort", nil))
+	}, "http.ErrAbortHandler is re-raised, so net/http aborts the response")
+}
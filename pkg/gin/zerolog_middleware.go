@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"time"
 
+	radixnet "github.com/equinor/radix-common/net"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
@@ -12,11 +13,25 @@ import (
 
 type SetZerologLoggerFn func(context.Context) zerolog.Logger
 
-// ZerologLoggerWithRequestId returns a zerolog logger with a request_id field with a new GUID
+// ZerologLoggerWithRequestId returns a zerolog logger with a request_id field with a new GUID,
+// or the logger in ctx unchanged when TraceContext has already added the request_id field
 func ZerologLoggerWithRequestId(ctx context.Context) zerolog.Logger {
+	if _, ok := radixnet.TraceContextFromContext(ctx); ok {
+		return *zerolog.Ctx(ctx)
+	}
 	return zerolog.Ctx(ctx).With().Str("request_id", xid.New().String()).Logger()
 }
 
+// TraceContext parses incoming traceparent, tracestate and X-Request-Id headers, and attaches a W3C trace context
+// and a zerolog logger with trace_id, span_id and request_id fields to a shallow copy of the gin request context.
+// Use radixnet.InjectTraceContext to propagate the trace context to outgoing requests
+func TraceContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = radixnet.StartTraceContext(c.Writer, c.Request)
+		c.Next()
+	}
+}
+
 // SetZerologLogger attaches the zerolog logger returned from each loggerFns function to a shallow copy of the gin request context
 // The logger can then be accessed in a controller method by calling zerolog.Ctx(ctx)
 func SetZerologLogger(loggerFns ...SetZerologLoggerFn) gin.HandlerFunc {
@@ -0,0 +1,56 @@
+package gin
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	radixnet "github.com/equinor/radix-common/net"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_TraceContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var logOutput bytes.Buffer
+	var actual radixnet.TraceContext
+	var outgoing http.Header
+	engine := gin.New()
+	engine.Use(
+		SetZerologLogger(func(context.Context) zerolog.Logger { return zerolog.New(&logOutput) }),
+		TraceContext(),
+		SetZerologLogger(ZerologLoggerWithRequestId),
+	)
+	engine.GET("/any", func(c *gin.Context) {
+		actual, _ = radixnet.TraceContextFromContext(c.Request.Context())
+		outgoing = http.Header{}
+		radixnet.InjectTraceContext(c.Request.Context(), outgoing)
+		zerolog.Ctx(c.Request.Context()).Info().Msg("any")
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/any", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("X-Request-Id", "any-request-id")
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", actual.TraceID, "The incoming trace is continued")
+	assert.NotEqual(t, "00f067aa0ba902b7", actual.SpanID, "The request has its own span")
+	assert.Equal(t, "any-request-id", w.Header().Get("X-Request-Id"))
+	assert.Contains(t, logOutput.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+	assert.Contains(t, logOutput.String(), `"span_id":"`+actual.SpanID+`"`)
+	assert.Equal(t, 1, strings.Count(logOutput.String(), `"request_id":`), "ZerologLoggerWithRequestId does not add request_id again")
+	assert.Contains(t, logOutput.String(), `"request_id":"any-request-id"`, "The request id of the trace context is logged")
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+actual.SpanID+"-01", outgoing.Get("traceparent"))
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/any", nil))
+	assert.Len(t, actual.TraceID, 32, "A new trace is started without traceparent")
+	assert.NotEmpty(t, w.Header().Get("X-Request-Id"))
+}
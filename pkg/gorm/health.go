@@ -0,0 +1,19 @@
+package gorm
+
+import (
+	"context"
+
+	"github.com/equinor/radix-common/net/health"
+	"gorm.io/gorm"
+)
+
+// PingCheck Health check pinging the database of the gorm connection
+func PingCheck(db *gorm.DB) health.CheckFunc {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
@@ -0,0 +1,49 @@
+package gorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+type fakeConnector struct {
+	pingErr error
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn(c), nil }
+func (c fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct {
+	pingErr error
+}
+
+func (c fakeConn) Ping(context.Context) error               { return c.pingErr }
+func (c fakeConn) Prepare(string) (driver.Stmt, error)      { return nil, errors.New("not supported") }
+func (c fakeConn) Close() error                             { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)                { return nil, errors.New("not supported") }
+func (c fakeConn) ResetSession(context.Context) error       { return nil }
+func (c fakeConn) IsValid() bool                            { return true }
+func (c fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func newTestDB(t *testing.T, pingErr error) *gorm.DB {
+	sqlDB := sql.OpenDB(fakeConnector{pingErr: pingErr})
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	return &gorm.DB{Config: &gorm.Config{ConnPool: sqlDB}}
+}
+
+func Test_PingCheck(t *testing.T) {
+	assert.NoError(t, PingCheck(newTestDB(t, nil))(context.Background()))
+
+	pingErr := errors.New("any error")
+	assert.ErrorIs(t, PingCheck(newTestDB(t, pingErr))(context.Background()), pingErr)
+}
+
+func Test_PingCheck_InvalidDB(t *testing.T) {
+	db := &gorm.DB{Config: &gorm.Config{}}
+	assert.ErrorIs(t, PingCheck(db)(context.Background()), gorm.ErrInvalidDB)
+}
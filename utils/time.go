@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"sync"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -60,7 +61,9 @@ func (c RealClock) Now() time.Time {
 	return time.Now()
 }
 
+// FakeClock Clock for tests, safe for concurrent use
 type FakeClock struct {
+	mu  sync.Mutex
 	now time.Time
 }
 
@@ -69,5 +72,14 @@ func NewFakeClock(now time.Time) *FakeClock {
 }
 
 func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.now
 }
+
+// Advance moves the fake clock forward by d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FakeClock_ConcurrentUse(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			clock.Advance(time.Second)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = clock.Now()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, start.Add(10*time.Second), clock.Now())
+}
@@ -52,6 +52,29 @@ func (tw *TimeWindow) Contains(t time.Time) bool {
 	return (loctime.After(start) || loctime.Equal(start)) && (loctime.Before(end) || loctime.Equal(end))
 }
 
+// End returns the first instant after the window containing t, or false when t is not within this time window.
+func (tw *TimeWindow) End(t time.Time) (time.Time, bool) {
+	if !tw.Contains(t) {
+		return time.Time{}, false
+	}
+	loctime := t.In(tw.location)
+	end := time.Date(loctime.Year(), loctime.Month(), loctime.Day(), tw.endTime.Hour(), tw.endTime.Minute(), tw.endTime.Second(), 0, tw.location)
+	return end.Add(time.Second), true
+}
+
+// NextStart returns the start of the first window starting after t, or false when the time window has no days.
+func (tw *TimeWindow) NextStart(t time.Time) (time.Time, bool) {
+	loctime := t.In(tw.location)
+	for d := 0; d <= 7; d++ {
+		day := loctime.AddDate(0, 0, d)
+		start := time.Date(day.Year(), day.Month(), day.Day(), tw.startTime.Hour(), tw.startTime.Minute(), tw.startTime.Second(), 0, tw.location)
+		if tw.days.Contains(start.Weekday()) && start.After(t) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
 // String returns a string representation of this time window.
 func (tw *TimeWindow) String() string {
 	return fmt.Sprintf("%s between %02d:%02d and %02d:%02d %s", tw.days.String(), tw.startTime.Hour(), tw.startTime.Minute(), tw.endTime.Hour(), tw.endTime.Minute(), tw.location.String())
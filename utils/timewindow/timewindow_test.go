@@ -60,3 +60,32 @@ func TestTimeWindows(t *testing.T) {
 		}
 	}
 }
+
+func TestTimeWindowBoundaries(t *testing.T) {
+	tw, err := New([]string{"mon", "wed"}, "10:00", "11:30", "UTC")
+	if err != nil {
+		t.Fatalf("failed to create TimeWindow: %v", err)
+	}
+
+	wednesday := time.Date(2019, 4, 10, 10, 15, 0, 0, time.UTC)
+	if end, ok := tw.End(wednesday); !ok || !end.Equal(time.Date(2019, 4, 10, 11, 30, 1, 0, time.UTC)) {
+		t.Errorf("End(%s) = %s, %v", wednesday, end, ok)
+	}
+	if _, ok := tw.End(wednesday.Add(2 * time.Hour)); ok {
+		t.Errorf("End outside the window should not be found")
+	}
+
+	cases := []struct {
+		time     time.Time
+		expected time.Time
+	}{
+		{time.Date(2019, 4, 8, 9, 0, 0, 0, time.UTC), time.Date(2019, 4, 8, 10, 0, 0, 0, time.UTC)},
+		{time.Date(2019, 4, 8, 10, 0, 0, 0, time.UTC), time.Date(2019, 4, 10, 10, 0, 0, 0, time.UTC)},
+		{wednesday, time.Date(2019, 4, 15, 10, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		if start, ok := tw.NextStart(c.time); !ok || !start.Equal(c.expected) {
+			t.Errorf("NextStart(%s) = %s, expected %s", c.time, start, c.expected)
+		}
+	}
+}